@@ -1,27 +1,66 @@
 package config
 
 import (
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/ownership"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"os"
 	"strings"
+	"time"
 )
 
 type Configuration struct {
-	MyPAT               string
-	GitRepo             string
-	ConfigFile          string
-	SecureApiToken      string
-	SysdigApiEndpoint   string
-	GroupingLabel       string
-	Silent              bool
-	StaticZones         map[string]bool
-	TeamZoneMappingFile string
-	TeamTemplateName    string
-	LogLevel            string
-	Mode                string
-	TeamPrefix          string
-	DryRun              bool
+	MyPAT                  string
+	GitRepo                string
+	ConfigFile             string
+	SecureApiToken         string
+	SysdigApiEndpoint      string
+	GroupingLabel          string
+	GroupingLabels         []string
+	GroupingTemplate       string
+	ZoneNameTemplate       string
+	ZoneDescTemplate       string
+	MissingLabelMode       string
+	MissingLabelDefault    string
+	FallbackLabels         []string
+	UnassignedGroup        string
+	IncludeClusters        []string
+	ExcludeClusters        []string
+	IncludeNamespaces      []string
+	ExcludeNamespaces      []string
+	IncludeLabels          []string
+	ExcludeLabels          []string
+	StaleThreshold         time.Duration
+	NamespaceSource        string
+	NamespaceFiles         []string
+	Kubeconfigs            []string
+	MDSClusters            []string
+	MDSRequiredLabels      []string
+	EntityType             string
+	CacheDir               string
+	CacheTTL               time.Duration
+	Refresh                bool
+	Silent                 bool
+	StaticZones            map[string]bool
+	TeamZoneMappingFile    string
+	TeamUsersFile          string
+	TargetScopeMappingFile string
+	ZoneDefinitionsFile    string
+	MergeStrategy          string
+	ZoneAliases            map[string]string
+	DetectRenames          bool
+	Ownership              ownership.Marker
+	TeamTemplateName       string
+	LogLevel               string
+	Mode                   string
+	Command                string
+	ZonesFile              string
+	TeamPrefix             string
+	TeamCleanup            string
+	ZoneCleanup            string
+	TeamUserOwnedFields    []string
+	DryRun                 bool
 }
 
 func getOSEnvString(logger *logrus.Logger, environmentVariable string, optional bool) string {
@@ -38,6 +77,26 @@ func getOSEnvString(logger *logrus.Logger, environmentVariable string, optional
 	return env
 }
 
+// getFlagOrOSEnvString returns the command line value when it was passed, otherwise it falls back to the environment variable
+func getFlagOrOSEnvString(logger *logrus.Logger, flagValue string, flagName string, environmentVariable string, optional bool) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	logger.Infof("'%s' not found on the command line.  Checking '%s' environment variable instead", flagName, environmentVariable)
+	return getOSEnvString(logger, environmentVariable, optional)
+}
+
+// splitList splits a comma separated list, trimming whitespace and dropping empty entries
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 /*func getOSEnvBool(logger *logrus.Logger, environmentVariable string, optional bool) bool {
 	env := os.Getenv(environmentVariable)
 	if env == "" {
@@ -72,6 +131,41 @@ func (c *Configuration) Build(logger *logrus.Logger) error {
 	var LogLevel string
 	var mode string
 	var teamPrefix string
+	var groupingTemplate string
+	var zoneNameTemplate string
+	var zoneDescTemplate string
+	var missingLabelMode string
+	var missingLabelDefault string
+	var fallbackLabels string
+	var unassignedGroup string
+	var includeClusters string
+	var excludeClusters string
+	var includeNamespaces string
+	var excludeNamespaces string
+	var includeLabels string
+	var excludeLabels string
+	var staleThreshold string
+	var namespaceSource string
+	var namespaceFiles string
+	var kubeconfigs string
+	var mdsClusters string
+	var mdsRequiredLabels string
+	var entityType string
+	var cacheDir string
+	var cacheTTL string
+	var boolRefresh bool
+	var targetScopeMappingFile string
+	var mergeStrategy string
+	var zonesFile string
+	var teamCleanup string
+	var zoneCleanup string
+	var teamUsersFile string
+	var teamUserOwnedFields string
+	var zoneDefinitionsFile string
+	var zoneAliases string
+	var boolDetectRenames bool
+	var ownershipMarker string
+	var ownershipMode string
 
 	pflag.StringVarP(&groupingLabel, "grouping-label", "l", "", "Label to group by")
 	pflag.StringVarP(&teamZoneMappingFile, "team-zone-mapping", "m", "", "CSV file to load for team to zone mapping")
@@ -79,19 +173,164 @@ func (c *Configuration) Build(logger *logrus.Logger) error {
 	pflag.StringVarP(&LogLevel, "log-level", "d", "", "Logging Level. INFO, DEBUG or ERROR")
 	pflag.StringVarP(&mode, "mode", "o", "", "Operation mode.  ZONE or TEAM")
 	pflag.StringVarP(&teamPrefix, "team-prefix", "t", "", "Team Name Prefix")
+	pflag.StringVar(&zoneNameTemplate, "zone-name-template", "", "Go template used to name zones")
+	pflag.StringVar(&zoneDescTemplate, "zone-description-template", "", "Go template used to describe zones")
+	pflag.StringVar(&groupingTemplate, "grouping-template", "", "Go template used to name groups built from multiple grouping labels")
+	pflag.StringVar(&missingLabelMode, "missing-label-mode", "", "Behaviour when a grouping label is missing. skip, default or fallback")
+	pflag.StringVar(&fallbackLabels, "fallback-labels", "", "Ordered, comma separated labels to group by when the grouping labels are missing")
+	pflag.StringVar(&unassignedGroup, "unassigned-group", "", "Group name for namespaces that match no grouping or fallback label")
+	pflag.StringVar(&includeClusters, "include-clusters", "", "Comma separated cluster name patterns to include")
+	pflag.StringVar(&excludeClusters, "exclude-clusters", "", "Comma separated cluster name patterns to exclude")
+	pflag.StringVar(&includeNamespaces, "include-namespaces", "", "Comma separated namespace name patterns to include")
+	pflag.StringVar(&excludeNamespaces, "exclude-namespaces", "", "Comma separated namespace name patterns to exclude")
+	pflag.StringVar(&includeLabels, "include-labels", "", "Comma separated 'label=pattern' filters to include")
+	pflag.StringVar(&excludeLabels, "exclude-labels", "", "Comma separated 'label=pattern' filters to exclude")
+	pflag.StringVar(&staleThreshold, "stale-threshold", "", "Exclude namespaces MDS has not seen within this duration, e.g. 168h")
+	pflag.StringVar(&namespaceSource, "namespace-source", "", "Where namespaces are loaded from. mds, file or kubectl")
+	pflag.StringVar(&namespaceFiles, "namespace-files", "", "Comma separated namespace inventory files ('path' or 'cluster=path') for --namespace-source=file")
+	pflag.StringVar(&kubeconfigs, "kubeconfigs", "", "Comma separated kubeconfigs ('path' or 'cluster=path') for --namespace-source=kubectl")
+	pflag.StringVar(&mdsClusters, "mds-clusters", "", "Comma separated clusters to request from MDS, filtered server side")
+	pflag.StringVar(&mdsRequiredLabels, "mds-required-labels", "", "Comma separated labels MDS entities must carry, filtered server side")
+	pflag.StringVar(&entityType, "entity-type", "", "MDS entity type to build zones from. k8s_cluster, k8s_namespace, k8s_deployment, k8s_statefulset or k8s_daemonset")
+	pflag.StringVar(&cacheDir, "cache-dir", "", "Directory for cached MDS and zone snapshots")
+	pflag.StringVar(&cacheTTL, "cache-ttl", "", "How long cached MDS and zone snapshots are used for, e.g. 30m. Caching is off when not set")
+	pflag.BoolVar(&boolRefresh, "refresh", false, "Ignore cached snapshots and download fresh ones")
+	pflag.StringVar(&targetScopeMappingFile, "target-scope-mapping", "", "CSV file mapping zones to aws, gcp, azure, host and image scope rules")
+	pflag.StringVar(&ownershipMarker, "ownership-marker", "", "Marker identifying zones and teams created by the scoper")
+	pflag.StringVar(&ownershipMode, "ownership-mode", "", "Where the ownership marker is stamped. description or prefix")
+	pflag.StringVar(&zoneAliases, "zone-aliases", "", "Comma separated 'old name=new name' zone renames")
+	pflag.BoolVar(&boolDetectRenames, "detect-renames", false, "Rename owned zones no group maps to anymore when their scope overlaps a new zone")
+	pflag.StringVar(&zoneDefinitionsFile, "zone-definitions", "", "YAML or JSON file of hand curated zones reconciled in zone mode")
+	pflag.StringVar(&teamUserOwnedFields, "team-user-owned-fields", "", "Comma separated team fields monitor mode leaves alone. agentScope, role or permissions")
+	pflag.StringVar(&teamUsersFile, "team-users", "", "CSV or YAML file mapping users and their roles to teams")
+	pflag.StringVar(&zoneCleanup, "zone-cleanup", "", "What to do with owned zones no group maps to anymore. none or delete")
+	pflag.StringVar(&teamCleanup, "team-cleanup", "", "What to do with owned teams no longer in the mapping or a group. none, delete or strip-zones")
+	pflag.StringVar(&zonesFile, "zones-file", "", "YAML or JSON file 'zones export' writes and 'zones import' reads")
+	pflag.StringVar(&mergeStrategy, "merge-strategy", "", "How generated zone scopes are merged with existing ones. replace, append or managed-scopes-only")
+	pflag.StringVar(&missingLabelDefault, "missing-label-default", "", "Value to use for a missing grouping label when --missing-label-mode=default")
 
 	pflag.BoolVarP(&boolSilent, "silent", "s", false, "Run Silently without dryrun prompt")
 	pflag.BoolVarP(&boolDryRun, "dryrun", "r", false, "DryRun mode.  Will not actually do anything irrespective of even --silent/-s ")
 
 	pflag.Parse()
 
+	// A command, e.g. 'zones export', runs on its own instead of the MODE operations
+	c.Command = strings.ToLower(strings.Join(pflag.Args(), " "))
+	switch c.Command {
+	case "":
+	case "zones export", "zones import":
+		if c.ZonesFile = getFlagOrOSEnvString(logger, zonesFile, "zones-file", "ZONES_FILE", true); c.ZonesFile == "" {
+			return fmt.Errorf("'%s' requires ZONES_FILE", c.Command)
+		}
+	default:
+		return fmt.Errorf("unknown command '%s', expected 'zones export' or 'zones import'", c.Command)
+	}
+
 	if groupingLabel == "" {
 		logger.Info("'grouping-label' not  found on the command line.  Checking 'GROUPING_LABEL' environment variable instead")
-		c.GroupingLabel = getOSEnvString(logger, "GROUPING_LABEL", false)
+		c.GroupingLabel = getOSEnvString(logger, "GROUPING_LABEL", c.Command != "")
 	} else {
 		c.GroupingLabel = groupingLabel
 	}
 
+	// GroupingLabel may hold an ordered, comma separated list of labels to build composite groups from
+	c.GroupingLabels = splitList(c.GroupingLabel)
+	c.GroupingTemplate = getFlagOrOSEnvString(logger, groupingTemplate, "grouping-template", "GROUPING_TEMPLATE", true)
+	c.ZoneNameTemplate = getFlagOrOSEnvString(logger, zoneNameTemplate, "zone-name-template", "ZONE_NAME_TEMPLATE", true)
+	c.ZoneDescTemplate = getFlagOrOSEnvString(logger, zoneDescTemplate, "zone-description-template", "ZONE_DESCRIPTION_TEMPLATE", true)
+	c.MissingLabelMode = getFlagOrOSEnvString(logger, missingLabelMode, "missing-label-mode", "MISSING_LABEL_MODE", true)
+	if c.MissingLabelMode == "" {
+		c.MissingLabelMode = "skip"
+	}
+	c.MissingLabelDefault = getFlagOrOSEnvString(logger, missingLabelDefault, "missing-label-default", "MISSING_LABEL_DEFAULT", true)
+	c.FallbackLabels = splitList(getFlagOrOSEnvString(logger, fallbackLabels, "fallback-labels", "FALLBACK_LABELS", true))
+	c.UnassignedGroup = getFlagOrOSEnvString(logger, unassignedGroup, "unassigned-group", "UNASSIGNED_GROUP", true)
+
+	// Filters applied to namespaces before grouping
+	c.IncludeClusters = splitList(getFlagOrOSEnvString(logger, includeClusters, "include-clusters", "INCLUDE_CLUSTERS", true))
+	c.ExcludeClusters = splitList(getFlagOrOSEnvString(logger, excludeClusters, "exclude-clusters", "EXCLUDE_CLUSTERS", true))
+	c.IncludeNamespaces = splitList(getFlagOrOSEnvString(logger, includeNamespaces, "include-namespaces", "INCLUDE_NAMESPACES", true))
+	c.ExcludeNamespaces = splitList(getFlagOrOSEnvString(logger, excludeNamespaces, "exclude-namespaces", "EXCLUDE_NAMESPACES", true))
+	c.IncludeLabels = splitList(getFlagOrOSEnvString(logger, includeLabels, "include-labels", "INCLUDE_LABELS", true))
+	c.ExcludeLabels = splitList(getFlagOrOSEnvString(logger, excludeLabels, "exclude-labels", "EXCLUDE_LABELS", true))
+
+	c.NamespaceSource = strings.ToLower(getFlagOrOSEnvString(logger, namespaceSource, "namespace-source", "NAMESPACE_SOURCE", true))
+	if c.NamespaceSource == "" {
+		c.NamespaceSource = "mds"
+	}
+	c.NamespaceFiles = splitList(getFlagOrOSEnvString(logger, namespaceFiles, "namespace-files", "NAMESPACE_FILES", true))
+	c.Kubeconfigs = splitList(getFlagOrOSEnvString(logger, kubeconfigs, "kubeconfigs", "KUBECONFIGS", true))
+	c.MDSClusters = splitList(getFlagOrOSEnvString(logger, mdsClusters, "mds-clusters", "MDS_CLUSTERS", true))
+	c.MDSRequiredLabels = splitList(getFlagOrOSEnvString(logger, mdsRequiredLabels, "mds-required-labels", "MDS_REQUIRED_LABELS", true))
+	c.EntityType = getFlagOrOSEnvString(logger, entityType, "entity-type", "ENTITY_TYPE", true)
+	if c.EntityType == "" {
+		c.EntityType = "k8s_namespace"
+	}
+	if c.NamespaceSource != "mds" && c.EntityType != "k8s_namespace" {
+		return fmt.Errorf("entity type '%s' is only supported with the 'mds' namespace source", c.EntityType)
+	}
+	switch c.NamespaceSource {
+	case "mds":
+	case "file":
+		if len(c.NamespaceFiles) == 0 {
+			return fmt.Errorf("namespace source 'file' requires NAMESPACE_FILES")
+		}
+	case "kubectl":
+		if len(c.Kubeconfigs) == 0 {
+			return fmt.Errorf("namespace source 'kubectl' requires KUBECONFIGS")
+		}
+	default:
+		return fmt.Errorf("unknown namespace source '%s'", c.NamespaceSource)
+	}
+
+	c.TargetScopeMappingFile = getFlagOrOSEnvString(logger, targetScopeMappingFile, "target-scope-mapping", "TARGET_SCOPE_MAPPING", true)
+	c.ZoneDefinitionsFile = getFlagOrOSEnvString(logger, zoneDefinitionsFile, "zone-definitions", "ZONE_DEFINITIONS", true)
+
+	c.MergeStrategy = strings.ToLower(getFlagOrOSEnvString(logger, mergeStrategy, "merge-strategy", "MERGE_STRATEGY", true))
+	switch c.MergeStrategy {
+	case "":
+		c.MergeStrategy = "replace"
+	case "replace", "append", "managed-scopes-only":
+	default:
+		return fmt.Errorf("unknown merge strategy '%s'", c.MergeStrategy)
+	}
+
+	// Zone aliases map the old zone name to the new one so the zone is renamed in place rather than recreated
+	c.ZoneAliases = make(map[string]string)
+	for _, alias := range splitList(getFlagOrOSEnvString(logger, zoneAliases, "zone-aliases", "ZONE_ALIASES", true)) {
+		parts := strings.SplitN(alias, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("invalid zone alias '%s', expected 'old name=new name'", alias)
+		}
+		c.ZoneAliases[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	c.DetectRenames = boolDetectRenames || strings.EqualFold(getOSEnvString(logger, "DETECT_RENAMES", true), "true")
+
+	var err error
+	if c.Ownership, err = ownership.NewMarker(getFlagOrOSEnvString(logger, ownershipMarker, "ownership-marker", "OWNERSHIP_MARKER", true),
+		strings.ToLower(getFlagOrOSEnvString(logger, ownershipMode, "ownership-mode", "OWNERSHIP_MODE", true))); err != nil {
+		return err
+	}
+
+	c.CacheDir = getFlagOrOSEnvString(logger, cacheDir, "cache-dir", "CACHE_DIR", true)
+	if c.CacheDir == "" {
+		c.CacheDir = ".zone-scoper-cache"
+	}
+	if cacheTTL = getFlagOrOSEnvString(logger, cacheTTL, "cache-ttl", "CACHE_TTL", true); cacheTTL != "" {
+		var err error
+		if c.CacheTTL, err = time.ParseDuration(cacheTTL); err != nil {
+			return fmt.Errorf("invalid cache TTL '%s': %v", cacheTTL, err)
+		}
+	}
+	c.Refresh = boolRefresh
+
+	if staleThreshold = getFlagOrOSEnvString(logger, staleThreshold, "stale-threshold", "STALE_THRESHOLD", true); staleThreshold != "" {
+		var err error
+		if c.StaleThreshold, err = time.ParseDuration(staleThreshold); err != nil {
+			return fmt.Errorf("invalid stale threshold '%s': %v", staleThreshold, err)
+		}
+	}
+
 	if teamZoneMappingFile == "" {
 		logger.Info("'team-zone-mapping' not  found on the command line.  Checking 'TEAM_ZONE_MAPPING' environment variable instead")
 		c.TeamZoneMappingFile = getOSEnvString(logger, "TEAM_ZONE_MAPPING", true)
@@ -108,7 +347,7 @@ func (c *Configuration) Build(logger *logrus.Logger) error {
 
 	if mode == "" {
 		logger.Info("'mode' not found on the command line.  Checking 'MODE' environment variable instead")
-		c.Mode = getOSEnvString(logger, "MODE", false)
+		c.Mode = getOSEnvString(logger, "MODE", c.Command != "")
 	} else {
 		c.Mode = mode
 	}
@@ -127,6 +366,25 @@ func (c *Configuration) Build(logger *logrus.Logger) error {
 		c.TeamPrefix = teamPrefix
 	}
 
+	c.TeamUsersFile = getFlagOrOSEnvString(logger, teamUsersFile, "team-users", "TEAM_USERS", true)
+	c.TeamUserOwnedFields = splitList(getFlagOrOSEnvString(logger, teamUserOwnedFields, "team-user-owned-fields", "TEAM_USER_OWNED_FIELDS", true))
+	c.ZoneCleanup = strings.ToLower(getFlagOrOSEnvString(logger, zoneCleanup, "zone-cleanup", "ZONE_CLEANUP", true))
+	switch c.ZoneCleanup {
+	case "":
+		c.ZoneCleanup = "none"
+	case "none", "delete":
+	default:
+		return fmt.Errorf("unknown zone cleanup '%s'", c.ZoneCleanup)
+	}
+	c.TeamCleanup = strings.ToLower(getFlagOrOSEnvString(logger, teamCleanup, "team-cleanup", "TEAM_CLEANUP", true))
+	switch c.TeamCleanup {
+	case "":
+		c.TeamCleanup = "none"
+	case "none", "delete", "strip-zones":
+	default:
+		return fmt.Errorf("unknown team cleanup '%s'", c.TeamCleanup)
+	}
+
 	c.Silent = boolSilent
 	c.DryRun = boolDryRun
 	if c.DryRun {
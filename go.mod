@@ -5,6 +5,7 @@ go 1.21.1
 require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
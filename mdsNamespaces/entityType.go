@@ -0,0 +1,57 @@
+package mdsNamespaces
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EntityType describes an MDS entity type zones can be generated from and which labels identify it.
+type EntityType struct {
+	Name           string // MDS entity type
+	NeedsNamespace bool   // Entity lives in a namespace
+	WorkloadLabel  string // Label holding the workload name, empty for non workload types
+	WorkloadKind   string // Kubernetes kind used in workloadType zone rules
+}
+
+var EntityTypes = map[string]EntityType{
+	"k8s_cluster":     {Name: "k8s_cluster"},
+	"k8s_namespace":   {Name: "k8s_namespace", NeedsNamespace: true},
+	"k8s_deployment":  {Name: "k8s_deployment", NeedsNamespace: true, WorkloadLabel: "kubernetes.deployment.name", WorkloadKind: "Deployment"},
+	"k8s_statefulset": {Name: "k8s_statefulset", NeedsNamespace: true, WorkloadLabel: "kubernetes.statefulset.name", WorkloadKind: "StatefulSet"},
+	"k8s_daemonset":   {Name: "k8s_daemonset", NeedsNamespace: true, WorkloadLabel: "kubernetes.daemonset.name", WorkloadKind: "DaemonSet"},
+}
+
+// LookupEntityType returns the entity type by MDS name, defaulting to k8s_namespace when empty.
+func LookupEntityType(name string) (EntityType, error) {
+	if name == "" {
+		name = "k8s_namespace"
+	}
+	entityType, exists := EntityTypes[name]
+	if !exists {
+		var names []string
+		for known := range EntityTypes {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return EntityType{}, fmt.Errorf("unsupported entity type '%s', expected one of %v", name, names)
+	}
+	return entityType, nil
+}
+
+// IsWorkload reports whether the entity type is a workload within a namespace.
+func (t EntityType) IsWorkload() bool {
+	return t.WorkloadLabel != ""
+}
+
+// ClusterNamespace returns the cluster, namespace and workload identifying the entity, ok is false when any label the
+// type needs is missing.
+func (t EntityType) ClusterNamespace(entity Entity) (cn ClusterNamespace, ok bool) {
+	cn.Cluster = entity.Labels["kubernetes.cluster.name"]
+	if t.NeedsNamespace {
+		cn.Namespace = entity.Labels["kubernetes.namespace.name"]
+	}
+	if t.IsWorkload() {
+		cn.Workload = entity.Labels[t.WorkloadLabel]
+	}
+	return cn, cn.Cluster != "" && (!t.NeedsNamespace || cn.Namespace != "") && (!t.IsWorkload() || cn.Workload != "")
+}
@@ -0,0 +1,188 @@
+package mdsNamespaces
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+const (
+	FilterCluster   = "cluster"
+	FilterNamespace = "namespace"
+	FilterLabel     = "label"
+)
+
+// FilterRule includes or excludes entities whose cluster, namespace or label value matches a pattern. Patterns are
+// globs ('*' and '?') unless prefixed with 're:', in which case they are regular expressions matched against the whole value.
+type FilterRule struct {
+	Include bool
+	Field   string
+	Label   string
+	Pattern string
+	regex   *regexp.Regexp
+}
+
+// Filters holds the filter rules applied before grouping and how many entities each rule filtered out.
+type Filters struct {
+	Rules    []*FilterRule
+	Filtered map[string]int
+}
+
+// NewFilterRule compiles a single filter rule.
+func NewFilterRule(include bool, field string, label string, pattern string) (*FilterRule, error) {
+	var expression string
+	if strings.HasPrefix(pattern, "re:") {
+		expression = fmt.Sprintf("^(?:%s)$", strings.TrimPrefix(pattern, "re:"))
+	} else {
+		expression = regexp.QuoteMeta(pattern)
+		expression = strings.ReplaceAll(expression, `\*`, ".*")
+		expression = strings.ReplaceAll(expression, `\?`, ".")
+		expression = fmt.Sprintf("^%s$", expression)
+	}
+
+	regex, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s filter pattern '%s': %v", field, pattern, err)
+	}
+	return &FilterRule{Include: include, Field: field, Label: label, Pattern: pattern, regex: regex}, nil
+}
+
+// NewFilters builds include and exclude rules for clusters, namespaces and labels. Label patterns take the form 'label=pattern'.
+func NewFilters(includeClusters, excludeClusters, includeNamespaces, excludeNamespaces, includeLabels, excludeLabels []string) (*Filters, error) {
+	f := &Filters{Filtered: make(map[string]int)}
+
+	add := func(include bool, field string, patterns []string) error {
+		for _, pattern := range patterns {
+			label := ""
+			if field == FilterLabel {
+				parts := strings.SplitN(pattern, "=", 2)
+				if len(parts) != 2 || parts[0] == "" {
+					return fmt.Errorf("label filter '%s' must be in the form 'label=pattern'", pattern)
+				}
+				label, pattern = parts[0], parts[1]
+			}
+			rule, err := NewFilterRule(include, field, label, pattern)
+			if err != nil {
+				return err
+			}
+			f.Rules = append(f.Rules, rule)
+		}
+		return nil
+	}
+
+	for _, err := range []error{
+		add(true, FilterCluster, includeClusters),
+		add(false, FilterCluster, excludeClusters),
+		add(true, FilterNamespace, includeNamespaces),
+		add(false, FilterNamespace, excludeNamespaces),
+		add(true, FilterLabel, includeLabels),
+		add(false, FilterLabel, excludeLabels),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// target returns the field the rule applies to, e.g. "namespace" or "label 'kubernetes.namespace.label.tier'"
+func (r *FilterRule) target() string {
+	if r.Field == FilterLabel {
+		return fmt.Sprintf("%s '%s'", FilterLabel, r.Label)
+	}
+	return r.Field
+}
+
+func (r *FilterRule) String() string {
+	action := "exclude"
+	if r.Include {
+		action = "include"
+	}
+	return fmt.Sprintf("%s %s '%s'", action, r.target(), r.Pattern)
+}
+
+// Matches reports whether the entity's value for the rule's field matches the pattern.
+func (r *FilterRule) Matches(entity Entity) bool {
+	var value string
+	switch r.Field {
+	case FilterCluster:
+		value = entity.Labels["kubernetes.cluster.name"]
+	case FilterNamespace:
+		value = entity.Labels["kubernetes.namespace.name"]
+	default:
+		value = entity.Labels[r.Label]
+	}
+	return r.regex.MatchString(value)
+}
+
+// Keep reports whether the entity passes every filter. When it does not, reason names the rule that filtered it out.
+// An entity is excluded by any matching exclude rule, and must match at least one include rule for every field that has them.
+func (f *Filters) Keep(entity Entity) (keep bool, reason string) {
+	included := make(map[string]bool)
+	for _, rule := range f.Rules {
+		if !rule.Include {
+			if rule.Matches(entity) {
+				return false, rule.String()
+			}
+			continue
+		}
+		if _, seen := included[rule.target()]; !seen {
+			included[rule.target()] = false
+		}
+		if rule.Matches(entity) {
+			included[rule.target()] = true
+		}
+	}
+
+	for _, rule := range f.Rules {
+		if rule.Include && !included[rule.target()] {
+			return false, f.includeReason(rule.target())
+		}
+	}
+	return true, ""
+}
+
+// includeReason names the include rules for a field, e.g. "include namespace 'app-*', 'web-*'"
+func (f *Filters) includeReason(target string) string {
+	var patterns []string
+	for _, rule := range f.Rules {
+		if rule.Include && rule.target() == target {
+			patterns = append(patterns, fmt.Sprintf("'%s'", rule.Pattern))
+		}
+	}
+	return fmt.Sprintf("include %s %s", target, strings.Join(patterns, ", "))
+}
+
+// SummaryRules returns the rule names filtered counts are recorded against, in rule order.
+func (f *Filters) SummaryRules() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, rule := range f.Rules {
+		name := rule.String()
+		if rule.Include {
+			name = f.includeReason(rule.target())
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Reset clears the filtered counts so every pass over the entities is counted on its own.
+func (f *Filters) Reset() {
+	f.Filtered = make(map[string]int)
+}
+
+// Apply reports whether the entity passes the filters, counting it against the rule that filtered it out when it does not.
+func (f *Filters) Apply(logger *logrus.Logger, entity Entity) bool {
+	keep, reason := f.Keep(entity)
+	if !keep {
+		logger.Debugf("Filtered Cluster '%s', Namespace '%s' by rule %s",
+			entity.Labels["kubernetes.cluster.name"], entity.Labels["kubernetes.namespace.name"], reason)
+		f.Filtered[reason]++
+	}
+	return keep
+}
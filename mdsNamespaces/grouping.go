@@ -0,0 +1,329 @@
+package mdsNamespaces
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	MissingLabelSkip     = "skip"     // Skip entities missing any grouping label
+	MissingLabelDefault  = "default"  // Use a default value in place of the missing label
+	MissingLabelFallback = "fallback" // Drop the missing label and fall back to the next label in the list
+)
+
+// Grouping describes how entities are grouped by an ordered list of labels and how each group is named.
+type Grouping struct {
+	Labels           []string
+	NameTemplate     *template.Template
+	MissingLabelMode string
+	MissingDefault   string
+	FallbackLabels   []string // Tried in order, using the raw label value, when the grouping labels do not produce a name
+	UnassignedGroup  string   // Group for entities nothing else matched. Empty leaves them ungrouped
+	EntityType       EntityType
+}
+
+// GroupNameData is passed to the grouping name template.
+type GroupNameData struct {
+	Values    []string          // Label values in grouping order, after missing label handling
+	Labels    map[string]string // Label name to value for every label that was found on the entity
+	Cluster   string
+	Namespace string
+	Workload  string
+}
+
+// GroupResult holds the distinct cluster/namespace pairs per group, the label values every member of each group shares
+// and every cluster/namespace pair that could not be assigned a group from its labels. Groups whose labels do not fully
+// describe them, because a member was missing a grouping label or members built the name from different labels, are
+// Incomplete. All slices are sorted by cluster then namespace so output is deterministic between runs.
+type GroupResult struct {
+	Groups     map[string][]ClusterNamespace
+	Labels     map[string]map[string]string
+	Incomplete map[string]bool
+	Unassigned []ClusterNamespace
+}
+
+// GroupMatch is the group an entity resolves to. Assigned is false when no grouping or fallback label matched and the
+// entity went to the unassigned group. Complete is false when a grouping label was missing.
+type GroupMatch struct {
+	Name     string
+	Labels   map[string]string
+	Complete bool
+	Assigned bool
+}
+
+// Grouper accumulates entities into groups, de-duplicating cluster/namespace pairs with a set per group.
+type Grouper struct {
+	grouping   *Grouping
+	seen       map[string]map[ClusterNamespace]struct{}
+	unassigned map[ClusterNamespace]struct{}
+	result     *GroupResult
+}
+
+var groupingTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// NewGrouping validates the grouping options and parses the naming template. An empty template joins the values with " - ".
+func NewGrouping(labels []string, nameTemplate string, missingLabelMode string, missingDefault string) (*Grouping, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("at least one grouping label is required")
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(missingLabelMode))
+	switch mode {
+	case "":
+		mode = MissingLabelSkip
+	case MissingLabelSkip, MissingLabelFallback:
+	case MissingLabelDefault:
+		if missingDefault == "" {
+			return nil, fmt.Errorf("missing label mode '%s' requires a default value", MissingLabelDefault)
+		}
+	default:
+		return nil, fmt.Errorf("unknown missing label mode '%s'", missingLabelMode)
+	}
+
+	if nameTemplate == "" {
+		nameTemplate = `{{ join .Values " - " }}`
+	}
+	tmpl, err := template.New("grouping").Funcs(groupingTemplateFuncs).Option("missingkey=zero").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse grouping template: %v", err)
+	}
+
+	return &Grouping{
+		Labels:           labels,
+		NameTemplate:     tmpl,
+		MissingLabelMode: mode,
+		MissingDefault:   missingDefault,
+		EntityType:       EntityTypes["k8s_namespace"],
+	}, nil
+}
+
+// GroupName resolves the group name for an entity. ok is false when the entity should not be grouped. The returned
+// labels contain only the grouping labels actually present on the entity.
+func (g *Grouping) GroupName(entity Entity) (name string, labels map[string]string, ok bool, err error) {
+	data := GroupNameData{
+		Labels:    make(map[string]string),
+		Cluster:   entity.Labels["kubernetes.cluster.name"],
+		Namespace: entity.Labels["kubernetes.namespace.name"],
+		Workload:  entity.Labels[g.EntityType.WorkloadLabel],
+	}
+
+	for _, label := range g.Labels {
+		value := entity.Labels[label]
+		if value != "" {
+			data.Values = append(data.Values, value)
+			data.Labels[label] = value
+			continue
+		}
+
+		switch g.MissingLabelMode {
+		case MissingLabelDefault:
+			data.Values = append(data.Values, g.MissingDefault)
+		case MissingLabelFallback:
+			// Nothing to add, the next label found takes this label's place
+		default:
+			return "", nil, false, nil
+		}
+	}
+
+	if len(data.Labels) == 0 {
+		return "", nil, false, nil
+	}
+
+	var buf bytes.Buffer
+	if err = g.NameTemplate.Execute(&buf, data); err != nil {
+		return "", nil, false, fmt.Errorf("could not render group name for '%s': %v", entity.Name, err)
+	}
+	name = strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", nil, false, nil
+	}
+	return name, data.Labels, true, nil
+}
+
+// FallbackName resolves the group name from the first fallback label present on the entity.
+func (g *Grouping) FallbackName(entity Entity) (name string, labels map[string]string, ok bool) {
+	for _, label := range g.FallbackLabels {
+		if value := strings.TrimSpace(entity.Labels[label]); value != "" {
+			return value, map[string]string{label: value}, true
+		}
+	}
+	return "", nil, false
+}
+
+// Match resolves the entity's group from the grouping labels, then the fallback labels and then the unassigned group.
+// ok is false when the entity has no group. An error rendering the group name is returned along with the fallback match.
+func (g *Grouping) Match(entity Entity) (match GroupMatch, ok bool, err error) {
+	match.Name, match.Labels, ok, err = g.GroupName(entity)
+	match.Complete = ok && len(match.Labels) == len(g.Labels)
+	if !ok {
+		match.Name, match.Labels, ok = g.FallbackName(entity)
+		match.Complete = ok
+	}
+	match.Assigned = ok
+	if !ok && g.UnassignedGroup != "" {
+		match.Name, match.Labels, ok = g.UnassignedGroup, map[string]string{}, true
+	}
+	return match, ok, err
+}
+
+// ScopeLabels returns every label a group name can be built from, grouping labels first.
+func (g *Grouping) ScopeLabels() []string {
+	return append(append([]string{}, g.Labels...), g.FallbackLabels...)
+}
+
+// NewGrouper creates an empty Grouper for the grouping.
+func NewGrouper(grouping *Grouping) *Grouper {
+	return &Grouper{
+		grouping:   grouping,
+		seen:       make(map[string]map[ClusterNamespace]struct{}),
+		unassigned: make(map[ClusterNamespace]struct{}),
+		result: &GroupResult{
+			Groups:     make(map[string][]ClusterNamespace),
+			Labels:     make(map[string]map[string]string),
+			Incomplete: make(map[string]bool),
+		},
+	}
+}
+
+// Add resolves the entity's group and records its cluster/namespace pair against it.
+func (gr *Grouper) Add(logging *logrus.Logger, entity Entity) {
+	clusterNamespace, ok := gr.grouping.EntityType.ClusterNamespace(entity)
+	if !ok {
+		logging.Infof("Cluster == '%s', Namespace == '%s', Workload == '%s'.  Skipping...",
+			clusterNamespace.Cluster, clusterNamespace.Namespace, clusterNamespace.Workload)
+		return // Skip entities without complete cluster, namespace or workload info
+	}
+	cluster, namespace := clusterNamespace.Cluster, clusterNamespace.Namespace
+
+	match, ok, err := gr.grouping.Match(entity)
+	if err != nil {
+		logging.Warnf("%v. Trying fallback labels...", err)
+	}
+	if !match.Assigned {
+		if _, exists := gr.unassigned[clusterNamespace]; !exists {
+			gr.unassigned[clusterNamespace] = struct{}{}
+			gr.result.Unassigned = append(gr.result.Unassigned, clusterNamespace)
+		}
+		if !ok {
+			logging.Debugf("No grouping or fallback label found for Cluster '%s', Namespace '%s'. Skipping...", cluster, namespace)
+			return
+		}
+		logging.Debugf("No grouping or fallback label found for Cluster '%s', Namespace '%s'. Assigning to '%s'", cluster, namespace, match.Name)
+	}
+	groupName, groupLabels, complete := match.Name, match.Labels, match.Complete
+
+	members, exists := gr.seen[groupName]
+	if !exists {
+		members = make(map[ClusterNamespace]struct{})
+		gr.seen[groupName] = members
+		gr.result.Labels[groupName] = groupLabels
+	} else if !sameLabels(gr.result.Labels[groupName], groupLabels) {
+		// Members built the same name from different labels, only the labels they agree on describe the group
+		gr.result.Labels[groupName] = commonLabels(gr.result.Labels[groupName], groupLabels)
+		complete = false
+	}
+	if !complete {
+		gr.result.Incomplete[groupName] = true
+	}
+	if _, found := members[clusterNamespace]; !found {
+		logging.Debugf("Adding Cluster '%s', Namespace '%s', Workload '%s' to distinct slice", cluster, namespace, clusterNamespace.Workload)
+		members[clusterNamespace] = struct{}{}
+		gr.result.Groups[groupName] = append(gr.result.Groups[groupName], clusterNamespace)
+	}
+}
+
+func sameLabels(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for label, value := range a {
+		if other, exists := b[label]; !exists || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// commonLabels returns the labels with the same value in both
+func commonLabels(a map[string]string, b map[string]string) map[string]string {
+	common := make(map[string]string)
+	for label, value := range a {
+		if other, exists := b[label]; exists && other == value {
+			common[label] = value
+		}
+	}
+	return common
+}
+
+// Result sorts and returns the groups accumulated so far.
+func (gr *Grouper) Result() *GroupResult {
+	for _, members := range gr.result.Groups {
+		SortClusterNamespaces(members)
+	}
+	SortClusterNamespaces(gr.result.Unassigned)
+	return gr.result
+}
+
+// GroupNames returns the group names in sorted order.
+func (r *GroupResult) GroupNames() []string {
+	names := make([]string, 0, len(r.Groups))
+	for name := range r.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortClusterNamespaces sorts cluster/namespace pairs by cluster, namespace then workload.
+func SortClusterNamespaces(cns []ClusterNamespace) {
+	sort.Slice(cns, func(i, j int) bool {
+		if cns[i].Cluster != cns[j].Cluster {
+			return cns[i].Cluster < cns[j].Cluster
+		}
+		if cns[i].Namespace != cns[j].Namespace {
+			return cns[i].Namespace < cns[j].Namespace
+		}
+		return cns[i].Workload < cns[j].Workload
+	})
+}
+
+// DistinctWorkloads returns the sorted, distinct workload names in the pairs.
+func DistinctWorkloads(cns []ClusterNamespace) (workloads []string) {
+	workloadSet := make(map[string]struct{})
+	for _, cn := range cns {
+		if _, exists := workloadSet[cn.Workload]; !exists && cn.Workload != "" {
+			workloadSet[cn.Workload] = struct{}{}
+			workloads = append(workloads, cn.Workload)
+		}
+	}
+	sort.Strings(workloads)
+	return workloads
+}
+
+// DistinctClustersNamespaces returns the sorted, distinct clusters and namespaces in the pairs.
+func DistinctClustersNamespaces(cns []ClusterNamespace) (clusters []string, namespaces []string) {
+	clusterSet := make(map[string]struct{})
+	namespaceSet := make(map[string]struct{})
+	for _, cn := range cns {
+		if _, exists := clusterSet[cn.Cluster]; !exists {
+			clusterSet[cn.Cluster] = struct{}{}
+			clusters = append(clusters, cn.Cluster)
+		}
+		if _, exists := namespaceSet[cn.Namespace]; !exists && cn.Namespace != "" {
+			namespaceSet[cn.Namespace] = struct{}{}
+			namespaces = append(namespaces, cn.Namespace)
+		}
+	}
+	sort.Strings(clusters)
+	sort.Strings(namespaces)
+	return clusters, namespaces
+}
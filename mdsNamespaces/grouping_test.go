@@ -0,0 +1,165 @@
+package mdsNamespaces
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// syntheticEntities builds n namespace entities spread over 20 clusters and 50 product groups, every 10th missing its
+// product label so the fallback and unassigned paths are exercised too.
+func syntheticEntities(n int) []Entity {
+	entities := make([]Entity, 0, n)
+	for i := 0; i < n; i++ {
+		labels := map[string]string{
+			"kubernetes.cluster.name":              fmt.Sprintf("cluster-%02d", i%20),
+			"kubernetes.namespace.name":            fmt.Sprintf("namespace-%05d", i),
+			"kubernetes.namespace.label.env":       []string{"dev", "test", "prod"}[i%3],
+			"kubernetes.namespace.label.team-name": fmt.Sprintf("team-%02d", i%7),
+		}
+		if i%10 != 0 {
+			labels["kubernetes.namespace.label.product"] = fmt.Sprintf("product-%02d", i%50)
+		}
+		entities = append(entities, Entity{
+			UID:    fmt.Sprintf("uid-%05d", i),
+			Type:   "k8s_namespace",
+			Name:   labels["kubernetes.namespace.name"],
+			Labels: labels,
+		})
+	}
+	return entities
+}
+
+func newTestGrouping(tb testing.TB) *Grouping {
+	grouping, err := NewGrouping([]string{"kubernetes.namespace.label.product", "kubernetes.namespace.label.env"}, "", MissingLabelSkip, "")
+	if err != nil {
+		tb.Fatalf("NewGrouping failed: %v", err)
+	}
+	grouping.FallbackLabels = []string{"kubernetes.namespace.label.team-name"}
+	grouping.UnassignedGroup = "unassigned"
+	return grouping
+}
+
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.WarnLevel)
+	return logger
+}
+
+func groupEntities(grouping *Grouping, logger *logrus.Logger, entities []Entity) *GroupResult {
+	grouper := NewGrouper(grouping)
+	for _, entity := range entities {
+		grouper.Add(logger, entity)
+	}
+	return grouper.Result()
+}
+
+func TestGrouperDeterministic(t *testing.T) {
+	logger := discardLogger()
+	entities := syntheticEntities(5000)
+	// Duplicates must not change the result either
+	entities = append(entities, entities[:500]...)
+
+	shuffled := append([]Entity{}, entities...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	first := groupEntities(newTestGrouping(t), logger, entities)
+	second := groupEntities(newTestGrouping(t), logger, shuffled)
+
+	if !reflect.DeepEqual(first.GroupNames(), second.GroupNames()) {
+		t.Fatalf("group names differ between runs:\n%v\n%v", first.GroupNames(), second.GroupNames())
+	}
+	for _, name := range first.GroupNames() {
+		if !reflect.DeepEqual(first.Groups[name], second.Groups[name]) {
+			t.Errorf("members of group '%s' differ between runs", name)
+		}
+	}
+	if !reflect.DeepEqual(first.Unassigned, second.Unassigned) {
+		t.Errorf("unassigned namespaces differ between runs")
+	}
+	if !reflect.DeepEqual(first.Labels, second.Labels) || !reflect.DeepEqual(first.Incomplete, second.Incomplete) {
+		t.Errorf("group labels differ between runs")
+	}
+}
+
+func TestGrouperIncompleteGroups(t *testing.T) {
+	entity := func(namespace string, labels map[string]string) Entity {
+		labels["kubernetes.cluster.name"] = "cluster"
+		labels["kubernetes.namespace.name"] = namespace
+		return Entity{Name: namespace, Labels: labels}
+	}
+	tests := []struct {
+		name           string
+		mode           string
+		entities       []Entity
+		group          string
+		wantLabels     map[string]string
+		wantIncomplete bool
+	}{
+		{
+			name: "all labels",
+			mode: MissingLabelSkip,
+			entities: []Entity{
+				entity("a", map[string]string{"group": "API", "env": "prod"}),
+				entity("b", map[string]string{"group": "API", "env": "prod"}),
+			},
+			group:      "API - prod",
+			wantLabels: map[string]string{"group": "API", "env": "prod"},
+		},
+		{
+			name:           "default value",
+			mode:           MissingLabelDefault,
+			entities:       []Entity{entity("a", map[string]string{"group": "API"})},
+			group:          "API - unknown",
+			wantLabels:     map[string]string{"group": "API"},
+			wantIncomplete: true,
+		},
+		{
+			name: "fallback from different labels",
+			mode: MissingLabelFallback,
+			entities: []Entity{
+				entity("a", map[string]string{"group": "API"}),
+				entity("b", map[string]string{"env": "API"}),
+			},
+			group:          "API",
+			wantLabels:     map[string]string{},
+			wantIncomplete: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grouping, err := NewGrouping([]string{"group", "env"}, "", tt.mode, "unknown")
+			if err != nil {
+				t.Fatalf("NewGrouping failed: %v", err)
+			}
+			result := groupEntities(grouping, discardLogger(), tt.entities)
+			if _, exists := result.Groups[tt.group]; !exists {
+				t.Fatalf("group '%s' not found in %v", tt.group, result.GroupNames())
+			}
+			if !reflect.DeepEqual(result.Labels[tt.group], tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", result.Labels[tt.group], tt.wantLabels)
+			}
+			if result.Incomplete[tt.group] != tt.wantIncomplete {
+				t.Errorf("incomplete = %t, want %t", result.Incomplete[tt.group], tt.wantIncomplete)
+			}
+		})
+	}
+}
+
+func BenchmarkGrouper(b *testing.B) {
+	logger := discardLogger()
+	entities := syntheticEntities(40000)
+	grouping := newTestGrouping(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		groupEntities(grouping, logger, entities)
+	}
+}
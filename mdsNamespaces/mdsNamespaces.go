@@ -1,10 +1,15 @@
 package mdsNamespaces
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zoneRules"
 	"github.com/sirupsen/logrus"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type NamespacePayload struct {
@@ -23,61 +28,139 @@ type Entity struct {
 type ClusterNamespace struct {
 	Cluster   string
 	Namespace string
+	Workload  string // Only set for workload entity types
 }
 
-func (p *NamespacePayload) GetNamespaces(logger *logrus.Logger, configNS *sysdighttp.SysdigRequestConfig) (err error) {
+// EntityFunc is called for every entity as it is decoded.
+type EntityFunc func(entity Entity) error
+
+// MDSQuery narrows the getEntities query server side so less is downloaded.
+type MDSQuery struct {
+	EntityType     string   // MDS entity type, defaults to k8s_namespace
+	Clusters       []string // Only return entities in these clusters
+	RequiredLabels []string // Only return entities carrying all of these labels
+}
+
+// Filter renders the query as an MDS filter expression, empty when there is nothing to filter on.
+func (q MDSQuery) Filter() string {
+	var expressions []string
+	if len(q.Clusters) > 0 {
+		quoted := make([]string, len(q.Clusters))
+		for i, cluster := range q.Clusters {
+			quoted[i] = zoneRules.Quote(cluster)
+		}
+		expressions = append(expressions, fmt.Sprintf("kubernetes.cluster.name in (%s)", strings.Join(quoted, ",")))
+	}
+	for _, label := range q.RequiredLabels {
+		expressions = append(expressions, fmt.Sprintf("%s exists", label))
+	}
+	return strings.Join(expressions, " and ")
+}
+
+// StreamNamespaces retrieves the entities matching the query, namespaces unless the query names another entity type, decoding them one at a time and passing each to fn
+// rather than loading the whole payload into memory.
+func (p *NamespacePayload) StreamNamespaces(logger *logrus.Logger, configNS *sysdighttp.SysdigRequestConfig, query MDSQuery, fn EntityFunc) (err error) {
 	var objFetchNamespaceResponse *http.Response
 	configNS.Path = "/api/mds/getEntities"
+	entityType := query.EntityType
+	if entityType == "" {
+		entityType = "k8s_namespace"
+	}
 	configNS.Params = map[string]interface{}{
-		"type": "k8s_namespace",
+		"type": entityType,
+	}
+	if filter := query.Filter(); filter != "" {
+		logger.Debugf("Filtering mds entities by '%s'", filter)
+		configNS.Params["filter"] = filter
 	}
 
 	if objFetchNamespaceResponse, err = sysdighttp.SysdigRequest(logger, *configNS); err != nil {
-		logger.Fatalf("Could not retrieve namespaces")
+		logger.Errorf("Could not retrieve namespaces")
+		return err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(objFetchNamespaceResponse.Body)
 
-	if err = sysdighttp.ResponseBodyToJson(objFetchNamespaceResponse, &p); err != nil {
-		logger.Fatalf("Could not unmarshal namespace payload")
+	var count int
+	if count, err = DecodeEntities(objFetchNamespaceResponse.Body, fn); err != nil {
+		logger.Errorf("Could not decode namespace payload")
+		return err
 	}
+	logger.Debugf("Successfully streamed '%d' '%s' entities", count, entityType)
 	return nil
 }
 
-// DistinctClusterNamespaceByLabel organizes unique clusters and namespaces by product name.
-func (p *NamespacePayload) DistinctClusterNamespaceByLabel(logging *logrus.Logger, groupingLabel string) map[string][]ClusterNamespace {
-	result := make(map[string][]ClusterNamespace)
+// DecodeEntities stream decodes the "entities" array of an MDS payload, calling fn for each entity.
+func DecodeEntities(r io.Reader, fn EntityFunc) (count int, err error) {
+	decoder := json.NewDecoder(r)
+	if err = expectDelim(decoder, '{'); err != nil {
+		return 0, err
+	}
 
-	for _, entity := range p.Entities {
-		if entity.Labels[groupingLabel] == "" {
-			//logging.Debugf("Grouping Label '%s' == '' for namespace '%s'. Skipping...", groupingLabel, entity.Name)
-			continue // Skip entities without a product name
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return count, err
 		}
-
-		cluster := entity.Labels["kubernetes.cluster.name"]
-		namespace := entity.Labels["kubernetes.namespace.name"]
-		if cluster == "" || namespace == "" {
-			logging.Infof("Cluster == '%s', Namespace == '%s'.  Skipping...", cluster, namespace)
-			continue // Skip entities without complete cluster or namespace info
+		if key, _ := token.(string); key != "entities" {
+			// Skip anything that is not the entities array
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return count, err
+			}
+			continue
 		}
 
-		clusterNamespace := ClusterNamespace{Cluster: cluster, Namespace: namespace}
-
-		// Check if the cluster-namespace pair is already in the slice
-		found := false
-		for _, cn := range result[entity.Labels[groupingLabel]] {
-			if cn.Cluster == cluster && cn.Namespace == namespace {
-				found = true
-				break
+		// A null entities list holds no entities
+		if token, err = decoder.Token(); err != nil {
+			return count, err
+		}
+		if token == nil {
+			continue
+		}
+		if token != json.Delim('[') {
+			return count, fmt.Errorf("expected '[' in mds payload, found '%v'", token)
+		}
+		for decoder.More() {
+			var entity Entity
+			if err = decoder.Decode(&entity); err != nil {
+				return count, err
+			}
+			count++
+			if err = fn(entity); err != nil {
+				return count, err
 			}
 		}
-		if !found {
-			// Append the cluster-namespace pair to the slice if it's not already present
-			logging.Debugf("Adding Cluster '%s', Namespace '%s' to distinct slice", cluster, namespace)
-			result[entity.Labels[groupingLabel]] = append(result[entity.Labels[groupingLabel]], clusterNamespace)
+		if err = expectDelim(decoder, ']'); err != nil {
+			return count, err
 		}
 	}
+	return count, expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected '%v' in mds payload, found '%v'", delim, token)
+	}
+	return nil
+}
+
+// LastSeen returns when MDS last saw the entity, the zero time when it carries no timestamp.
+func (e Entity) LastSeen() time.Time {
+	if e.TimestampNs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, e.TimestampNs)
+}
 
-	return result
+// IsStale reports whether the entity was last seen before the threshold from now. Entities without a timestamp are never
+// stale as there is no way to tell how old they are.
+func (e Entity) IsStale(threshold time.Duration, now time.Time) bool {
+	lastSeen := e.LastSeen()
+	return threshold > 0 && !lastSeen.IsZero() && lastSeen.Before(now.Add(-threshold))
 }
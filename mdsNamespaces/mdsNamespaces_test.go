@@ -0,0 +1,40 @@
+package mdsNamespaces
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeEntities(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantCount int
+		wantErr   bool
+	}{
+		{"entities", `{"entities": [{"name": "a"}, {"name": "b"}], "total": 2}`, 2, false},
+		{"null entities", `{"entities": null}`, 0, false},
+		{"no entities", `{"total": 0}`, 0, false},
+		{"entities not a list", `{"entities": {}}`, 0, true},
+		{"truncated", `{"entities": [{"name": "a"}`, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := DecodeEntities(strings.NewReader(tt.payload), func(entity Entity) error { return nil })
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestMDSQueryFilter(t *testing.T) {
+	query := MDSQuery{Clusters: []string{"prod", `odd"name`}, RequiredLabels: []string{"kubernetes.namespace.label.team"}}
+	want := `kubernetes.cluster.name in ("prod","odd\"name") and kubernetes.namespace.label.team exists`
+	if got := query.Filter(); got != want {
+		t.Errorf("Filter() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+package mdsNamespaces
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/snapshotCache"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// NamespaceSource provides the namespace entities zones and teams are built from, passing each entity to fn in turn.
+type NamespaceSource interface {
+	StreamNamespaces(logger *logrus.Logger, fn EntityFunc) error
+}
+
+// MDSSource streams namespaces from the Sysdig MDS getEntities endpoint.
+type MDSSource struct {
+	Config sysdighttp.SysdigRequestConfig
+	Query  MDSQuery
+}
+
+// FileSource loads a namespace inventory from local files. Each file is either a JSON MDS payload, 'kubectl get ns -o json'
+// output or a CSV with 'Cluster' and 'Namespace' columns followed by one column per label. kubectl output carries no
+// cluster name so it must be given as the file's Cluster.
+type FileSource struct {
+	Files []InventoryPath
+}
+
+// KubectlSource loads namespaces by running 'kubectl get ns -o json' against each kubeconfig. The cluster name defaults
+// to the kubeconfig's current context.
+type KubectlSource struct {
+	Kubeconfigs []InventoryPath
+	Command     string
+}
+
+// InventoryPath is a file path with an optional cluster name.
+type InventoryPath struct {
+	Cluster string
+	Path    string
+}
+
+type kubectlNamespaceList struct {
+	Items []struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			UID    string            `json:"uid"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+// ParseInventoryPaths parses 'path' or 'cluster=path' entries.
+func ParseInventoryPaths(entries []string) []InventoryPath {
+	var paths []InventoryPath
+	for _, entry := range entries {
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			paths = append(paths, InventoryPath{Cluster: strings.TrimSpace(parts[0]), Path: strings.TrimSpace(parts[1])})
+		} else {
+			paths = append(paths, InventoryPath{Path: entry})
+		}
+	}
+	return paths
+}
+
+func (s *MDSSource) StreamNamespaces(logger *logrus.Logger, fn EntityFunc) error {
+	configNS := s.Config
+	return (&NamespacePayload{}).StreamNamespaces(logger, &configNS, s.Query, fn)
+}
+
+func (s *FileSource) StreamNamespaces(logger *logrus.Logger, fn EntityFunc) error {
+	for _, file := range s.Files {
+		logger.Infof("Loading namespace inventory '%s'", file.Path)
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("could not read namespace inventory '%s': %v", file.Path, err)
+		}
+
+		var entities []Entity
+		if strings.EqualFold(filepath.Ext(file.Path), ".csv") {
+			entities, err = parseInventoryCSV(bytes.NewReader(data), file.Cluster)
+		} else {
+			entities, err = parseInventoryJSON(data, file.Cluster)
+		}
+		if err != nil {
+			return fmt.Errorf("could not parse namespace inventory '%s': %v", file.Path, err)
+		}
+		logger.Debugf("Loaded %d namespaces from '%s'", len(entities), file.Path)
+		if err = streamEntities(entities, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KubectlSource) StreamNamespaces(logger *logrus.Logger, fn EntityFunc) error {
+	command := s.Command
+	if command == "" {
+		command = "kubectl"
+	}
+
+	for _, kubeconfig := range s.Kubeconfigs {
+		cluster := kubeconfig.Cluster
+		if cluster == "" {
+			output, err := exec.Command(command, "--kubeconfig", kubeconfig.Path, "config", "current-context").Output()
+			if err != nil {
+				return fmt.Errorf("could not get current context of kubeconfig '%s': %v", kubeconfig.Path, err)
+			}
+			cluster = strings.TrimSpace(string(output))
+		}
+
+		logger.Infof("Getting namespaces for cluster '%s' with kubeconfig '%s'", cluster, kubeconfig.Path)
+		output, err := exec.Command(command, "--kubeconfig", kubeconfig.Path, "get", "ns", "-o", "json").Output()
+		if err != nil {
+			return fmt.Errorf("could not get namespaces with kubeconfig '%s': %v", kubeconfig.Path, err)
+		}
+
+		entities, err := parseInventoryJSON(output, cluster)
+		if err != nil {
+			return fmt.Errorf("could not parse namespaces from kubeconfig '%s': %v", kubeconfig.Path, err)
+		}
+		logger.Debugf("Loaded %d namespaces for cluster '%s'", len(entities), cluster)
+		if err = streamEntities(entities, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func streamEntities(entities []Entity, fn EntityFunc) error {
+	for _, entity := range entities {
+		if err := fn(entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseInventoryJSON parses either an MDS payload or 'kubectl get ns -o json' output.
+func parseInventoryJSON(data []byte, cluster string) ([]Entity, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if _, isKubectl := probe["items"]; !isKubectl {
+		var payload NamespacePayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		return payload.Entities, nil
+	}
+
+	if cluster == "" {
+		return nil, fmt.Errorf("kubectl namespace output needs a cluster name, pass it as 'cluster=path'")
+	}
+	var list kubectlNamespaceList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	var entities []Entity
+	for _, item := range list.Items {
+		labels := map[string]string{
+			"kubernetes.cluster.name":   cluster,
+			"kubernetes.namespace.name": item.Metadata.Name,
+		}
+		for key, value := range item.Metadata.Labels {
+			labels["kubernetes.namespace.label."+key] = value
+		}
+		entities = append(entities, Entity{
+			UID:    item.Metadata.UID,
+			Type:   "k8s_namespace",
+			Name:   item.Metadata.Name,
+			Labels: labels,
+		})
+	}
+	return entities, nil
+}
+
+// parseInventoryCSV parses a CSV with 'Cluster' and 'Namespace' columns, every other column is a label named by its header.
+func parseInventoryCSV(r io.Reader, cluster string) ([]Entity, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	clusterColumn, namespaceColumn := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "cluster":
+			clusterColumn = i
+		case "namespace":
+			namespaceColumn = i
+		}
+	}
+	if namespaceColumn == -1 || (clusterColumn == -1 && cluster == "") {
+		return nil, fmt.Errorf("inventory CSV needs 'Cluster' and 'Namespace' columns")
+	}
+
+	var entities []Entity
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		labels := make(map[string]string)
+		for i, value := range record {
+			if i != clusterColumn && i != namespaceColumn && value != "" {
+				labels[strings.TrimSpace(header[i])] = value
+			}
+		}
+		labels["kubernetes.cluster.name"] = cluster
+		if clusterColumn != -1 && record[clusterColumn] != "" {
+			labels["kubernetes.cluster.name"] = record[clusterColumn]
+		}
+		labels["kubernetes.namespace.name"] = record[namespaceColumn]
+
+		entities = append(entities, Entity{
+			Type:   "k8s_namespace",
+			Name:   record[namespaceColumn],
+			Labels: labels,
+		})
+	}
+	return entities, nil
+}
+
+// CachedSource serves namespaces from a cached NamespacePayload snapshot while it is fresh, otherwise it streams from
+// Source and saves what it streamed as the new snapshot.
+type CachedSource struct {
+	Source NamespaceSource
+	Cache  *snapshotCache.Cache
+	Key    string
+}
+
+func (s *CachedSource) StreamNamespaces(logger *logrus.Logger, fn EntityFunc) error {
+	var snapshot NamespacePayload
+	if ok, err := s.Cache.Load(logger, s.Key, &snapshot); err != nil {
+		logger.Warnf("Ignoring namespace cache. Error %v", err)
+	} else if ok {
+		return streamEntities(snapshot.Entities, fn)
+	}
+
+	// The snapshot has to be collected in full, trading the streaming memory savings for the cache
+	err := s.Source.StreamNamespaces(logger, func(entity Entity) error {
+		snapshot.Entities = append(snapshot.Entities, entity)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = s.Cache.Save(logger, s.Key, &snapshot); err != nil {
+		logger.Warnf("Could not save namespace cache. Error %v", err)
+	}
+	return streamEntities(snapshot.Entities, fn)
+}
@@ -0,0 +1,62 @@
+package ownership
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ModeDescription = "description" // The marker is appended to the description
+	ModePrefix      = "prefix"      // The marker prefixes the name
+
+	DefaultDescriptionMarker = "[managed-by:sysdig-zone-scoper]"
+	DefaultPrefixMarker      = "zs-"
+)
+
+// Marker stamps the zones and teams the scoper creates so cleanup only ever considers objects the scoper owns.
+type Marker struct {
+	Text string
+	Mode string
+}
+
+// NewMarker returns a marker for the mode, defaulting to the description mode and the mode's default marker text.
+func NewMarker(text string, mode string) (Marker, error) {
+	switch mode {
+	case "", ModeDescription:
+		mode = ModeDescription
+		if text == "" {
+			text = DefaultDescriptionMarker
+		}
+	case ModePrefix:
+		if text == "" {
+			text = DefaultPrefixMarker
+		}
+	default:
+		return Marker{}, fmt.Errorf("unknown ownership mode '%s', expected '%s' or '%s'", mode, ModeDescription, ModePrefix)
+	}
+	return Marker{Text: text, Mode: mode}, nil
+}
+
+// Name returns the name an owned object is created with, prefixed by the marker in prefix mode.
+func (m Marker) Name(name string) string {
+	if m.Mode == ModePrefix && !strings.HasPrefix(name, m.Text) {
+		return m.Text + name
+	}
+	return name
+}
+
+// Description returns the description an owned object is created with, carrying the marker in description mode.
+func (m Marker) Description(description string) string {
+	if m.Mode == ModeDescription && !strings.Contains(description, m.Text) {
+		return strings.TrimSpace(description + " " + m.Text)
+	}
+	return description
+}
+
+// IsOwned reports whether an object with the name and description carries the marker.
+func (m Marker) IsOwned(name string, description string) bool {
+	if m.Mode == ModePrefix {
+		return strings.HasPrefix(name, m.Text)
+	}
+	return strings.Contains(description, m.Text)
+}
@@ -0,0 +1,118 @@
+package snapshotCache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache stores JSON snapshots on disk keyed by endpoint so repeated runs can skip re-downloading them.
+type Cache struct {
+	Dir     string
+	TTL     time.Duration
+	Refresh bool // Ignore existing snapshots, but still save new ones
+}
+
+// NewCache creates a cache in dir. A ttl of zero or less disables the cache.
+func NewCache(dir string, ttl time.Duration, refresh bool) *Cache {
+	return &Cache{Dir: dir, TTL: ttl, Refresh: refresh}
+}
+
+// Enabled reports whether snapshots are read and written.
+func (c *Cache) Enabled() bool {
+	return c != nil && c.TTL > 0
+}
+
+// Key builds a file name safe cache key from the endpoint and the parts identifying the snapshot. The first part, e.g.
+// "zones", is kept readable and everything is hashed.
+func (c *Cache) Key(endpoint string, kind string, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{endpoint, kind}, parts...), "\x00")))
+	return fmt.Sprintf("%s-%s", kind, hex.EncodeToString(sum[:8]))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%s.json", key))
+}
+
+// Load decodes the snapshot for key into target. It returns false when the cache is disabled, refreshing, or the
+// snapshot is missing or older than the TTL.
+func (c *Cache) Load(logger *logrus.Logger, key string, target interface{}) (bool, error) {
+	if !c.Enabled() || c.Refresh {
+		return false, nil
+	}
+
+	info, err := os.Stat(c.path(key))
+	if os.IsNotExist(err) {
+		logger.Debugf("No cached snapshot for '%s'", key)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if age := time.Since(info.ModTime()); age > c.TTL {
+		logger.Debugf("Cached snapshot for '%s' is %s old, older than TTL '%s'", key, age.Round(time.Second), c.TTL)
+		return false, nil
+	}
+
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		return false, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	if err = json.NewDecoder(file).Decode(target); err != nil {
+		return false, fmt.Errorf("could not decode cached snapshot '%s': %v", key, err)
+	}
+	logger.Infof("Using cached snapshot '%s' from %s", key, info.ModTime().Format(time.RFC3339))
+	return true, nil
+}
+
+// Save writes the snapshot for key, replacing any existing one.
+func (c *Cache) Save(logger *logrus.Logger, key string, value interface{}) error {
+	if !c.Enabled() {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a truncated snapshot behind
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(tmp).Encode(value); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return err
+	}
+	logger.Debugf("Saved cached snapshot '%s'", key)
+	return nil
+}
+
+// Invalidate removes the snapshot for key, used once the cached data is known to have changed.
+func (c *Cache) Invalidate(logger *logrus.Logger, key string) {
+	if !c.Enabled() {
+		return
+	}
+	if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Could not remove cached snapshot '%s': %v", key, err)
+		return
+	}
+	logger.Debugf("Invalidated cached snapshot '%s'", key)
+}
@@ -6,16 +6,25 @@ import (
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/config"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/dataManipulation"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/mdsNamespaces"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/snapshotCache"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/targetScopeMapping"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/teamPayload"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/teamUserMapping"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/teamZoneMapping"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zoneFile"
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/zonePayload"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zoneRules"
 	"github.com/sirupsen/logrus"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
+const version = "v9.5.9"
+
 type customFormatter struct {
 	logrus.TextFormatter
 }
@@ -62,24 +71,126 @@ func (f *customFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	return []byte(logMessage), nil
 }
 
-func getMDSNamespaces(appConfig *config.Configuration, logger *logrus.Logger, mdsNs *mdsNamespaces.NamespacePayload) (err error) {
-	configMdsNamespaces := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-	return mdsNs.GetNamespaces(logger, &configMdsNamespaces)
+// newNamespaceSource returns the configured namespace source, defaulting to MDS. MDS is served from the snapshot cache when enabled
+func newNamespaceSource(appConfig *config.Configuration, cache *snapshotCache.Cache) mdsNamespaces.NamespaceSource {
+	switch appConfig.NamespaceSource {
+	case "file":
+		return &mdsNamespaces.FileSource{Files: mdsNamespaces.ParseInventoryPaths(appConfig.NamespaceFiles)}
+	case "kubectl":
+		return &mdsNamespaces.KubectlSource{Kubeconfigs: mdsNamespaces.ParseInventoryPaths(appConfig.Kubeconfigs)}
+	default:
+		source := &mdsNamespaces.MDSSource{
+			Config: sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken),
+			Query: mdsNamespaces.MDSQuery{
+				EntityType:     appConfig.EntityType,
+				Clusters:       appConfig.MDSClusters,
+				RequiredLabels: appConfig.MDSRequiredLabels,
+			},
+		}
+		if !cache.Enabled() {
+			return source
+		}
+		return &mdsNamespaces.CachedSource{
+			Source: source,
+			Cache:  cache,
+			Key:    cache.Key(appConfig.SysdigApiEndpoint, "mds", appConfig.EntityType, source.Query.Filter()),
+		}
+	}
+}
+
+// groupNamespaces streams the namespaces from the namespace source through the custom data manipulation, filters and
+// stale check straight into the grouping stage. The stale namespaces are returned so they can be reported.
+func groupNamespaces(appConfig *config.Configuration,
+	logger *logrus.Logger,
+	cache *snapshotCache.Cache,
+	grouping *mdsNamespaces.Grouping,
+	filters *mdsNamespaces.Filters) (*mdsNamespaces.GroupResult, []mdsNamespaces.Entity) {
+
+	grouper := mdsNamespaces.NewGrouper(grouping)
+	var stale []mdsNamespaces.Entity
+	now := time.Now()
+	filters.Reset() // Zone and monitor modes each group the namespaces, only count this pass
+
+	logger.Infof("Getting Namespace list from '%s'", appConfig.NamespaceSource)
+	err := newNamespaceSource(appConfig, cache).StreamNamespaces(logger, func(entity mdsNamespaces.Entity) error {
+		// Custom data manipulation
+		_ = dataManipulation.ManipulateEntity(logger, &entity)
+
+		if !filters.Apply(logger, entity) {
+			return nil
+		}
+		if entity.IsStale(appConfig.StaleThreshold, now) {
+			logger.Debugf("Cluster '%s', Namespace '%s' last seen %s. Dropping as stale", entity.Labels["kubernetes.cluster.name"],
+				entity.Labels["kubernetes.namespace.name"], entity.LastSeen().Format(time.RFC3339))
+			stale = append(stale, entity)
+			return nil
+		}
+		grouper.Add(logger, entity)
+		return nil
+	})
+	if err != nil {
+		logger.Fatalf("Failed to retrieve namespaces. Error %v", err)
+	}
+
+	logFilterSummary(logger, filters)
+	if len(stale) > 0 {
+		logger.Infof("%d namespaces not seen within '%s' excluded as stale", len(stale), appConfig.StaleThreshold)
+	}
+
+	groupResult := grouper.Result()
+	writeUnassignedReport(logger, groupResult.Unassigned)
+	return groupResult, stale
+}
+
+// logFilterSummary reports how many namespaces each filter rule removed
+func logFilterSummary(logger *logrus.Logger, filters *mdsNamespaces.Filters) {
+	if len(filters.Rules) == 0 {
+		return
+	}
+	logger.Info("Filter summary")
+	total := 0
+	for _, rule := range filters.SummaryRules() {
+		logger.Infof("  %-60s filtered %d", rule, filters.Filtered[rule])
+		total += filters.Filtered[rule]
+	}
+	logger.Infof("  %d namespaces filtered out in total", total)
 }
 
-func getZones(appConfig *config.Configuration, logger *logrus.Logger, zones *zonePayload.ZonePayload) (err error) {
+// getZones retrieves the zones, from the snapshot cache when it is enabled and fresh unless mutating. Zones that are
+// about to be created, updated or deleted must not be decided from a cached snapshot, so mutating always downloads them.
+func getZones(appConfig *config.Configuration, logger *logrus.Logger, cache *snapshotCache.Cache, zones *zonePayload.ZonePayload, mutating bool) (err error) {
+	cacheKey := zonesCacheKey(appConfig, cache)
+	if mutating {
+		logger.Debug("Zones will change, not using the zone cache")
+	} else if ok, err := cache.Load(logger, cacheKey, &zones.Zones); err != nil {
+		logger.Warnf("Ignoring zone cache. Error %v", err)
+	} else if ok {
+		return nil
+	}
+
 	configZones := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-	return zones.GetZones(logger, &configZones)
+	if err = zones.GetZones(logger, &configZones); err != nil {
+		return err
+	}
+	if err = cache.Save(logger, cacheKey, zones.Zones); err != nil {
+		logger.Warnf("Could not save zone cache. Error %v", err)
+	}
+	return nil
+}
+
+func zonesCacheKey(appConfig *config.Configuration, cache *snapshotCache.Cache) string {
+	return cache.Key(appConfig.SysdigApiEndpoint, "zones")
 }
 
 func createZone(appConfig *config.Configuration,
 	logger *logrus.Logger,
 	zones *zonePayload.ZonePayload,
-	productName string) (createdZone *zonePayload.Zone, err error) {
+	zoneName string,
+	description string) (createdZone *zonePayload.Zone, err error) {
 
 	var newZone = &zonePayload.CreateZone{
-		Name:        productName,
-		Description: fmt.Sprintf("Zone for '%s'", productName),
+		Name:        zoneName,
+		Description: appConfig.Ownership.Description(description),
 		Scopes: []zonePayload.Scope{{
 			Rules:      "",
 			TargetType: "kubernetes",
@@ -87,106 +198,364 @@ func createZone(appConfig *config.Configuration,
 	}
 
 	configCreateZone := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-	logger.Infof("Creating zone %s'", productName)
+	logger.Infof("Creating zone '%s'", zoneName)
 	createdZone, err = zones.CreateNewZone(logger, &configCreateZone, newZone)
 
 	return
 }
 
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
-
 func updateZone(appConfig *config.Configuration,
 	logger *logrus.Logger,
 	zones *zonePayload.ZonePayload,
 	distinctProductNames map[string][]mdsNamespaces.ClusterNamespace,
+	entityType mdsNamespaces.EntityType,
+	targetScopes *targetScopeMapping.TargetScopes,
 	productName string,
 	createdZone *zonePayload.Zone) (err error) {
 
-	var clusters []string
-	var namespaces []string
-	//Generate the comma lists of clusters and namespaces
-	for _, cn := range distinctProductNames[productName] {
-		logger.Debugf("Cluster: %s, Namespace: %s", cn.Cluster, cn.Namespace)
-		// Append cluster if not already in clusters
-		if !contains(clusters, cn.Cluster) {
-			clusters = append(clusters, cn.Cluster)
-		}
-
-		// Append namespace if not already in namespaces
-		if !contains(namespaces, cn.Namespace) {
-			namespaces = append(namespaces, cn.Namespace)
-		}
+	rules := zoneRules.Render(kubernetesRules(entityType, distinctProductNames[productName]))
+	logger.Debugf("Kubernetes rules: '%s'", rules)
+
+	// The kubernetes scope is always generated, other target types only when they are mapped for this zone
+	generated := []zonePayload.Scope{{
+		Rules:      rules,
+		TargetType: "kubernetes",
+	}}
+	for _, scpe := range mappedScopes(targetScopes, productName) {
+		logger.Debugf("%s rules: '%s'", scpe.TargetType, scpe.Rules)
+		generated = append(generated, scpe)
 	}
-
-	var joinedClusters = fmt.Sprintf("\"%s\"", strings.Join(clusters, "\",\""))
-	var joinedNamespaces = fmt.Sprintf("\"%s\"", strings.Join(namespaces, "\",\""))
-	logger.Debugf("Joined cluster string: '%s'", joinedClusters)
-	logger.Debugf("Joined namespace string: '%s'", joinedNamespaces)
-
-	// Create a new scope without kubernetes
-	var newScope []zonePayload.Scope
-	for _, scpe := range createdZone.Scopes {
-		if scpe.TargetType != "kubernetes" {
-			newScope = append(newScope, scpe)
-		}
-	}
-	// Add in our kubernetes scopes
-	newScope = append(newScope, zonePayload.Scope{
-		Rules:      fmt.Sprintf("clusterId in (%s) and namespace in (%s)", joinedClusters, joinedNamespaces),
-		TargetType: "kubernetes"},
-	)
+	newScope, managedScopes := mergeScopes(logger, appConfig.MergeStrategy, createdZone, generated)
 
 	//Update Zone
 	var updateZone = &zonePayload.UpdateZone{
-		ID:     createdZone.ID,
-		Name:   createdZone.Name,
-		Scopes: newScope,
+		ID:          createdZone.ID,
+		Name:        createdZone.Name,
+		Description: zonePayload.WithScopeMarker(createdZone.Description, managedScopes),
+		Scopes:      newScope,
 	}
 	configUpdate := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
 	configUpdate.JSON = updateZone
 	logger.Debugf("Updating zone '%s', zoneID %d", productName, createdZone.ID)
-	logger.Debugf("Cluster: '%s', Namespace: '%s'", updateZone.Scopes[len(updateZone.Scopes)-2].Rules, updateZone.Scopes[len(updateZone.Scopes)-1].Rules)
 	if err = zones.UpdateZone(logger, &configUpdate, updateZone); err != nil {
 		logger.Errorf("Could not update zoneId '%d' for '%s'", createdZone.ID, productName)
 	}
 	// Retrieve, modify, and set the Zone to mark it as kept
-	zone := zones.Zones[productName]
+	zone := zones.Zones[createdZone.Name]
 	zone.Keep = true
-	zones.Zones[productName] = zone
+	zones.Zones[createdZone.Name] = zone
 
 	logger.Debugf("Zone '%s' updated and marked as kept", productName)
 
 	return
 }
 
-func createClusterNSString(distinctProductNames map[string][]mdsNamespaces.ClusterNamespace, productName string) (joinedClusters string, joinedNamespaces string) {
-	var clusters []string
-	var namespaces []string
-	//Generate the comma lists of clusters and namespaces
-	for _, cn := range distinctProductNames[productName] {
-		// Append cluster if not already in clusters
-		if !contains(clusters, cn.Cluster) {
-			clusters = append(clusters, cn.Cluster)
+// nameZones renders the zone name and description for every group, keyed by group value. Names carry the ownership
+// prefix when configured, added before sanitising so the prefixed name fits, and must be unique as two groups can
+// sanitise to the same name. An existing zone already named with the unsanitised name keeps that name.
+func nameZones(appConfig *config.Configuration,
+	logger *logrus.Logger,
+	zones *zonePayload.ZonePayload,
+	naming *zonePayload.ZoneNaming,
+	groupResult *mdsNamespaces.GroupResult,
+	run zonePayload.RunMetadata) (names map[string]string, descriptions map[string]string, err error) {
+
+	names = make(map[string]string)
+	descriptions = make(map[string]string)
+	groupsByName := make(map[string]string)
+	for _, productName := range groupResult.GroupNames() {
+		cns := groupResult.Groups[productName]
+		clusters, _ := mdsNamespaces.DistinctClustersNamespaces(cns)
+		namespaces := make(map[mdsNamespaces.ClusterNamespace]struct{})
+		for _, cn := range cns {
+			if cn.Namespace != "" {
+				namespaces[mdsNamespaces.ClusterNamespace{Cluster: cn.Cluster, Namespace: cn.Namespace}] = struct{}{}
+			}
+		}
+		data := zonePayload.ZoneNameData{
+			Value:          productName,
+			Labels:         groupResult.Labels[productName],
+			Clusters:       clusters,
+			NamespaceCount: len(namespaces),
+			Run:            run,
+		}
+
+		var renderedName string
+		if renderedName, err = naming.Name(data); err != nil {
+			return nil, nil, err
+		}
+		renderedName = appConfig.Ownership.Name(renderedName)
+		zoneName := zonePayload.SanitizeZoneName(renderedName)
+		if _, exists := zones.Zones[renderedName]; exists {
+			zoneName = renderedName
+		} else if zoneName != renderedName {
+			logger.Warnf("Zone name '%s' for group '%s' sanitised to '%s'", renderedName, productName, zoneName)
+		}
+		if !appConfig.Ownership.IsOwned(zoneName, appConfig.Ownership.Description("")) {
+			return nil, nil, fmt.Errorf("ownership marker '%s' does not survive zone name sanitising", appConfig.Ownership.Text)
+		}
+		if other, exists := groupsByName[zoneName]; exists {
+			return nil, nil, fmt.Errorf("groups '%s' and '%s' both name zone '%s'", other, productName, zoneName)
+		}
+		groupsByName[zoneName] = productName
+		names[productName] = zoneName
+
+		if descriptions[productName], err = naming.Description(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	return names, descriptions, nil
+}
+
+// findRenamedZone finds the existing zone a new zone name replaces. An explicit alias from the old name always wins,
+// otherwise when rename detection is enabled the owned zone no group maps to anymore whose kubernetes scope overlaps the
+// generated rules the most is used. Ties are ambiguous and nothing is renamed.
+func findRenamedZone(appConfig *config.Configuration,
+	logger *logrus.Logger,
+	zones *zonePayload.ZonePayload,
+	groupZones map[string]bool,
+	claimedZones map[string]bool,
+	zoneName string,
+	rules zoneRules.Expr) (renamedZone zonePayload.Zone, found bool) {
+
+	var names []string
+	for name := range zones.Zones {
+		if !groupZones[name] && !claimedZones[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Aliases are written without the ownership prefix the zones are named with
+	aliases := make(map[string]string)
+	for oldName, newName := range appConfig.ZoneAliases {
+		aliases[appConfig.Ownership.Name(oldName)] = appConfig.Ownership.Name(newName)
+	}
+	for _, name := range names {
+		if aliases[name] == zoneName {
+			logger.Debugf("Zone '%s' is an alias of '%s'", name, zoneName)
+			return zones.Zones[name], true
+		}
+	}
+	if !appConfig.DetectRenames {
+		return zonePayload.Zone{}, false
+	}
+
+	bestScore, ambiguous := 0, false
+	for _, name := range names {
+		zone := zones.Zones[name]
+		if appConfig.StaticZones[name] || !appConfig.Ownership.IsOwned(zone.Name, zone.Description) {
+			continue
+		}
+		score := scopeOverlap(zone, rules)
+		switch {
+		case score > bestScore:
+			renamedZone, bestScore, ambiguous = zone, score, false
+		case score > 0 && score == bestScore:
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		logger.Warnf("Several zones overlap '%s' equally, not treating any as renamed", zoneName)
+		return zonePayload.Zone{}, false
+	}
+	if bestScore > 0 {
+		logger.Debugf("Zone '%s' overlaps '%s' on %d values", renamedZone.Name, zoneName, bestScore)
+	}
+	return renamedZone, bestScore > 0
+}
+
+// scopeOverlap counts the values a zone's kubernetes scopes share with the rules. A scope only counts when it shares at
+// least one value for every field the rules match on.
+func scopeOverlap(zone zonePayload.Zone, rules zoneRules.Expr) (overlap int) {
+	for _, scpe := range zone.Scopes {
+		if scpe.TargetType != "kubernetes" {
+			continue
+		}
+		existing, err := zoneRules.Parse(scpe.Rules)
+		if err != nil || existing == nil {
+			continue
+		}
+
+		scopeOverlap := 0
+		for _, comparison := range zoneRules.Comparisons(rules) {
+			values, ok := zoneRules.FieldValues(existing, comparison.Field)
+			if !ok {
+				scopeOverlap = 0
+				break
+			}
+			shared := 0
+			for _, value := range values {
+				for _, generated := range comparison.Values {
+					if value == generated {
+						shared++
+						break
+					}
+				}
+			}
+			if shared == 0 {
+				scopeOverlap = 0
+				break
+			}
+			scopeOverlap += shared
+		}
+		if scopeOverlap > overlap {
+			overlap = scopeOverlap
+		}
+	}
+	return overlap
+}
+
+// mergeScopes combines the zone's existing scopes with the generated ones according to the merge strategy. It returns
+// the new scopes along with those the scoper manages, to be recorded in the zone's scope marker. Existing scopes without
+// rules are placeholders left by zone creation and are always dropped. Zones written before the scope marker existed
+// have their kubernetes scope treated as managed, as the scoper always wrote it.
+func mergeScopes(logger *logrus.Logger,
+	strategy string,
+	zone *zonePayload.Zone,
+	generated []zonePayload.Scope) (scopes []zonePayload.Scope, managed []zonePayload.Scope) {
+
+	generatedTargetTypes := make(map[string]bool)
+	for _, scpe := range generated {
+		generatedTargetTypes[scpe.TargetType] = true
+	}
+
+	unmarked := !zonePayload.HasScopeMarker(zone.Description)
+	var existing []zonePayload.Scope
+	for _, scpe := range zone.Scopes {
+		if strings.TrimSpace(scpe.Rules) == "" {
+			continue
+		}
+		isManaged := zonePayload.IsManagedScope(zone.Description, scpe) || unmarked && scpe.TargetType == "kubernetes"
+		switch {
+		case strategy == zonePayload.MergeReplace && generatedTargetTypes[scpe.TargetType]:
+			logger.Debugf("Replacing existing %s rules '%s'", scpe.TargetType, scpe.Rules)
+		case strategy == zonePayload.MergeReplace && isManaged:
+			// The mapping no longer generates this managed scope, so it goes rather than lingering on the zone
+			logger.Debugf("Dropping managed %s rules '%s' no longer generated", scpe.TargetType, scpe.Rules)
+		case strategy == zonePayload.MergeManagedScopesOnly && isManaged:
+			logger.Debugf("Replacing managed %s rules '%s'", scpe.TargetType, scpe.Rules)
+		default:
+			existing = append(existing, scpe)
+			if isManaged {
+				managed = append(managed, scpe)
+			}
+		}
+	}
+
+	if strategy != zonePayload.MergeAppend {
+		return append(existing, generated...), append(managed, generated...)
+	}
+
+	// Append merges the generated values into the first existing scope of the same target type that matches on the same fields
+	for _, scpe := range generated {
+		generatedRules, _ := zoneRules.Parse(scpe.Rules)
+		merged := false
+		for i, existingScope := range existing {
+			if existingScope.TargetType != scpe.TargetType {
+				continue
+			}
+			existingRules, err := zoneRules.Parse(existingScope.Rules)
+			if err != nil {
+				logger.Warnf("Could not parse existing %s rules '%s'. Error %v", existingScope.TargetType, existingScope.Rules, err)
+				continue
+			}
+			if mergedRules, ok := zoneRules.Merge(existingRules, generatedRules); ok {
+				logger.Debugf("Merging %s rules '%s' into '%s'", scpe.TargetType, scpe.Rules, existingScope.Rules)
+				existing[i].Rules = zoneRules.Render(mergedRules)
+				managed = append(managed, existing[i])
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			existing = append(existing, scpe)
+			managed = append(managed, scpe)
 		}
+	}
+	return existing, managed
+}
 
-		// Append namespace if not already in namespaces
-		if !contains(namespaces, cn.Namespace) {
-			namespaces = append(namespaces, cn.Namespace)
+// kubernetesRules builds the kubernetes zone scope rules matching the entity type, clusters only for cluster entities,
+// clusters and namespaces for namespaces, and additionally the workload kind and names for workloads
+func kubernetesRules(entityType mdsNamespaces.EntityType, cns []mdsNamespaces.ClusterNamespace) zoneRules.Expr {
+	clusters, namespaces := mdsNamespaces.DistinctClustersNamespaces(cns)
+	rules := []zoneRules.Expr{zoneRules.In("clusterId", clusters...)}
+	if entityType.NeedsNamespace {
+		rules = append(rules, zoneRules.In("namespace", namespaces...))
+	}
+	if entityType.IsWorkload() {
+		rules = append(rules,
+			zoneRules.In("workloadType", entityType.WorkloadKind),
+			zoneRules.In("workloadName", mdsNamespaces.DistinctWorkloads(cns)...))
+	}
+	return zoneRules.AndOf(rules...)
+}
+
+// mappedScopes builds a scope for each non kubernetes target type mapped to the zone, every mapped field becomes an
+// 'in' clause and the clauses are joined with 'and'
+func mappedScopes(targetScopes *targetScopeMapping.TargetScopes, productName string) (scopes []zonePayload.Scope) {
+	if targetScopes == nil {
+		return nil
+	}
+	for _, targetType := range targetScopes.TargetTypesFor(productName) {
+		fields, values := targetScopes.Fields(productName, targetType)
+		var clauses []zoneRules.Expr
+		for _, field := range fields {
+			clauses = append(clauses, zoneRules.In(field, values[field]...))
 		}
+		scopes = append(scopes, zonePayload.Scope{
+			Rules:      zoneRules.Render(zoneRules.AndOf(clauses...)),
+			TargetType: targetType,
+		})
 	}
-	return fmt.Sprintf(strings.Join(clusters, ",")), fmt.Sprintf(strings.Join(namespaces, ","))
+	return scopes
 }
 
-func processDryRun() {
+// describeScopes summarises scopes for the dry run output, e.g. "aws: account in ("1234")"
+func describeScopes(scopes []zonePayload.Scope) string {
+	var descriptions []string
+	for _, scpe := range scopes {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", scpe.TargetType, scpe.Rules))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func createClusterNSString(distinctProductNames map[string][]mdsNamespaces.ClusterNamespace, productName string) (joinedClusters string, joinedNamespaces string, joinedWorkloads string) {
+	//Generate the comma lists of clusters, namespaces and workloads
+	clusters, namespaces := mdsNamespaces.DistinctClustersNamespaces(distinctProductNames[productName])
+	workloads := mdsNamespaces.DistinctWorkloads(distinctProductNames[productName])
+	return strings.Join(clusters, ","), strings.Join(namespaces, ","), strings.Join(workloads, ",")
+}
+
+// writeUnassignedReport lists every namespace that could not be grouped from its labels so nothing falls through the cracks
+func writeUnassignedReport(logger *logrus.Logger, unassigned []mdsNamespaces.ClusterNamespace) {
+	if len(unassigned) == 0 {
+		logger.Info("All namespaces were assigned a group")
+		return
+	}
+
+	file, err := os.Create("unassigned.csv")
+	if err != nil {
+		logger.Errorf("Could not create unassigned namespace report. Error %v", err)
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	_ = writer.Write([]string{"Cluster", "Namespace", "Workload"})
+	for _, cn := range unassigned {
+		logger.Debugf("Unassigned Cluster: '%s', Namespace: '%s', Workload: '%s'", cn.Cluster, cn.Namespace, cn.Workload)
+		_ = writer.Write([]string{cn.Cluster, cn.Namespace, cn.Workload})
+	}
+	logger.Warnf("%d namespaces could not be grouped from their labels, see \"unassigned.csv\"", len(unassigned))
+}
+
+func processDryRun(fileName string) {
 	// Inform the user that the file has been written
-	fmt.Println("\"dry-run.csv\" has been written. Do you wish to continue? [Y/N]")
+	fmt.Printf("\"%s\" has been written. Do you wish to continue? [Y/N]\n", fileName)
 
 	// Function to read user input
 	var response string
@@ -208,93 +577,376 @@ func processDryRun() {
 }
 
 func getTeamZoneMapping(logger *logrus.Logger, appConfig *config.Configuration) (error, *teamZoneMapping.TeamZones) {
-	teamZoneMappingFile, err := os.Open(appConfig.TeamZoneMappingFile)
-	if err != nil {
-		logger.Errorf("Error opening team zone mapping file: %v", err)
-		return err, nil // Return nil to indicate an error occurred
-	}
-	defer func(teamZoneMappingFile *os.File) {
-		_ = teamZoneMappingFile.Close()
-	}(teamZoneMappingFile)
-
 	teamZones := teamZoneMapping.NewTeamZones() // Initialize the TeamZones structure
-	if err := teamZones.ParseCSV(teamZoneMappingFile); err != nil {
-		logger.Errorf("Error parsing team zone mapping CSV: %v", err)
+	if err := teamZones.LoadFile(appConfig.TeamZoneMappingFile); err != nil {
+		logger.Errorf("Error loading team zone mapping '%s': %v", appConfig.TeamZoneMappingFile, err)
 		return err, nil // Return nil to indicate an error occurred
 	}
 
 	// Print the map to verify the contents
-	for team, zones := range *teamZones {
-		formattedZones := fmt.Sprintf("[\"%s\"]", strings.Join(zones, "\", \""))
-		logger.Infof("Team: %s, Zones: %v", team, formattedZones)
+	for team, mapping := range *teamZones {
+		formattedZones := fmt.Sprintf("[\"%s\"]", strings.Join(mapping.Zones, "\", \""))
+		logger.Infof("Team: %s, Zones: %v, Overrides: '%s'", team, formattedZones, mapping.Overrides)
 	}
 	return nil, teamZones
 }
 
+// getZoneDefinitions loads the hand curated zones, stamping them with the ownership marker so they are cleaned up once
+// removed from the file. A defined zone may not share its name with a label driven zone.
+func getZoneDefinitions(logger *logrus.Logger, appConfig *config.Configuration, zoneNames map[string]string) (*zoneFile.ZoneFile, error) {
+	definedZones, err := zoneFile.Load(appConfig.ZoneDefinitionsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	labelZones := make(map[string]string)
+	for productName, zoneName := range zoneNames {
+		labelZones[zoneName] = productName
+	}
+	for i, zone := range definedZones.Zones {
+		zone.Name = appConfig.Ownership.Name(zone.Name)
+		zone.Description = appConfig.Ownership.Description(zone.Description)
+		if productName, exists := labelZones[zone.Name]; exists {
+			return nil, fmt.Errorf("defined zone '%s' clashes with the zone for group '%s'", zone.Name, productName)
+		}
+		definedZones.Zones[i] = zone
+		logger.Debugf("Defined zone '%s' with scopes '%s'", zone.Name, describeScopes(zone.PayloadScopes()))
+	}
+	logger.Infof("Loaded %d defined zones from '%s'", len(definedZones.Zones), appConfig.ZoneDefinitionsFile)
+	return definedZones, nil
+}
+
+func getTargetScopeMapping(logger *logrus.Logger, appConfig *config.Configuration) (*targetScopeMapping.TargetScopes, error) {
+	targetScopeMappingFile, err := os.Open(appConfig.TargetScopeMappingFile)
+	if err != nil {
+		logger.Errorf("Error opening target scope mapping file: %v", err)
+		return nil, err
+	}
+	defer func(targetScopeMappingFile *os.File) {
+		_ = targetScopeMappingFile.Close()
+	}(targetScopeMappingFile)
+
+	targetScopes := targetScopeMapping.NewTargetScopes()
+	if err := targetScopes.ParseCSV(targetScopeMappingFile); err != nil {
+		logger.Errorf("Error parsing target scope mapping CSV: %v", err)
+		return nil, err
+	}
+
+	for group := range *targetScopes {
+		logger.Infof("Zone: %s, Target Types: %v", group, targetScopes.TargetTypesFor(group))
+	}
+	return targetScopes, nil
+}
+
 func createOrUpdateTeam(logger *logrus.Logger,
 	appConfig *config.Configuration,
+	teams *teamPayload.TeamIndex,
 	teamName string,
 	zoneIds []int64,
-	teamMapping *teamPayload.TeamPayload) (err error) {
+	teamMapping *teamPayload.TeamPayload,
+	overrides teamZoneMapping.TeamOverrides) (err error) {
 	tz := &teamPayload.TeamPayload{}
 	configCreateTeam := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
 
-	// Check if the team already exists, if so we will update (PUT) the team, else we will create (POST) it
-	tb := &teamPayload.TeamBase{}
-	configGetTeamByName := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-	if err = tb.GetTeamByName(logger, &configGetTeamByName, teamName); err != nil {
-		logger.Errorf("Could not execute query to ascertain if team '%s' exists. Error %v", teamName, err)
-		return err
+	// A team seeing all zones has no zone IDs of its own
+	if overrides.IsAllZones != nil && *overrides.IsAllZones {
+		zoneIds = nil
 	}
 
-	if len(tb.Data) > 0 {
+	// Check if the team already exists, if so we will update (PUT) the team, else we will create (POST) it
+	if existingTeam, exists := teams.Teams[teamName]; exists {
 		// Means we found the team and we need to run an update not a create
-		if err = tz.UpdateTeamZoneMapping(logger, teamName, zoneIds, &configCreateTeam, &tb.Data[0]); err != nil {
+		if overrides.Template != "" {
+			// An overriding template brings its role and permissions to the existing team, unless they are user owned
+			userOwned := map[string]bool{teamPayload.FieldAgentScope: true}
+			for _, field := range appConfig.TeamUserOwnedFields {
+				userOwned[field] = true
+			}
+			existingTeam, _ = existingTeam.Reconcile(teamMapping, "", userOwned)
+		}
+		applyTeamOverrides(&existingTeam, overrides)
+		if err = tz.UpdateTeamZoneMapping(logger, teamName, zoneIds, &configCreateTeam, &existingTeam); err != nil {
 			return err
 		}
 	} else {
-		if err = tz.CreateTeamZoneMapping(logger, appConfig, teamName, zoneIds, &configCreateTeam, teamMapping); err != nil {
+		newTeam := teamPayload.NewTeamFromTemplate(teamMapping)
+		applyTeamOverrides(&newTeam, overrides)
+		if err = tz.CreateTeamZoneMapping(logger, appConfig, teamName, appConfig.Ownership.Description(teamName), zoneIds, &configCreateTeam, &newTeam); err != nil {
 			return err
 		}
 	}
+	teams.Put(*tz)
 
 	return nil
 }
 
+// applyTeamOverrides sets the role, permissions and all zones flag the team mapping overrides on the team
+func applyTeamOverrides(team *teamPayload.TeamPayload, overrides teamZoneMapping.TeamOverrides) {
+	if overrides.StandardTeamRole != "" {
+		team.StandardTeamRole = overrides.StandardTeamRole
+		team.CustomTeamRoleID = nil
+	}
+	if overrides.CustomTeamRoleID != nil {
+		customTeamRoleID := *overrides.CustomTeamRoleID
+		team.CustomTeamRoleID = &customTeamRoleID
+		team.StandardTeamRole = ""
+	}
+	if overrides.IsAllZones != nil {
+		team.IsAllZones = *overrides.IsAllZones
+	}
+	for permission, value := range overrides.Permissions {
+		switch permission {
+		case "hasAgentCli":
+			team.AdditionalTeamPermissions.HasAgentCli = value
+		case "hasAwsData":
+			team.AdditionalTeamPermissions.HasAwsData = value
+		case "hasBeaconMetrics":
+			team.AdditionalTeamPermissions.HasBeaconMetrics = value
+		case "hasInfrastructureEvents":
+			team.AdditionalTeamPermissions.HasInfrastructureEvents = value
+		case "hasRapidResponse":
+			team.AdditionalTeamPermissions.HasRapidResponse = value
+		case "hasSysdigCaptures":
+			team.AdditionalTeamPermissions.HasSysdigCaptures = value
+		}
+	}
+}
+
 func cRUDTeamMonitor(logger *logrus.Logger,
 	appConfig *config.Configuration,
+	teams *teamPayload.TeamIndex,
 	teamName string,
-	keyName string,
+	scopeLabels []string,
+	groupLabels map[string]string,
 	teamMapping *teamPayload.TeamPayload) (err error) {
 	tz := &teamPayload.TeamPayload{}
 	configCreateTeam := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
 
 	// Check if the team already exists, if so we will update (PUT) the team, else we will create (POST) it
-	tb := &teamPayload.TeamBase{}
-	configGetTeamByName := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-	if err = tb.GetTeamByName(logger, &configGetTeamByName, teamName); err != nil {
-		logger.Errorf("Could not execute query to ascertain if team '%s' exists. Error %v", teamName, err)
-		return err
-	}
-
-	if len(tb.Data) == 0 {
-		teamMapping.Scopes = append(tz.Scopes, teamPayload.Scope{
+	if _, exists := teams.Teams[teamName]; !exists {
+		// The template stays untouched, the group's scopes only go on this team's copy
+		newTeam := teamPayload.NewTeamFromTemplate(teamMapping)
+		newTeam.Scopes = []teamPayload.Scope{{
 			Expression: "container",
 			Type:       "HOST_CONTAINER",
-		}, teamPayload.Scope{
-			Expression: fmt.Sprintf("%s = \"%s\"", appConfig.GroupingLabel, keyName),
+		}, {
+			Expression: groupScopeExpression(scopeLabels, groupLabels),
 			Type:       "AGENT",
-		})
+		}}
 		logger.Infof("Creating team: %s", teamName)
 		if !appConfig.DryRun {
-			if err = tz.CreateTeamZoneMapping(logger, appConfig, teamName, nil, &configCreateTeam, teamMapping); err != nil {
+			if err = tz.CreateTeamZoneMapping(logger, appConfig, teamName, appConfig.Ownership.Description(teamName), nil, &configCreateTeam, &newTeam); err != nil {
 				return err
 			}
+			teams.Put(*tz)
 		}
 	} else {
-		logger.Infof("Skipping existing team: %s", teamName)
+		// Existing teams follow the template and grouping, keeping their ID, members and user owned fields
+		existingTeam := teams.Teams[teamName]
+		userOwned := make(map[string]bool)
+		for _, field := range appConfig.TeamUserOwnedFields {
+			userOwned[field] = true
+		}
+		reconciledTeam, changed := existingTeam.Reconcile(teamMapping, groupScopeExpression(scopeLabels, groupLabels), userOwned)
+		if len(changed) == 0 {
+			logger.Infof("Team '%s' is up to date", teamName)
+			return nil
+		}
+		logger.Infof("Updating team '%s' fields %v", teamName, changed)
+		if !appConfig.DryRun {
+			if err = tz.UpdateTeamZoneMapping(logger, teamName, reconciledTeam.ZoneIds, &configCreateTeam, &reconciledTeam); err != nil {
+				return err
+			}
+			teams.Put(*tz)
+		}
+	}
+
+	return nil
+}
+
+// reconcileTeamUsers adds, updates and removes the memberships of the teams in the team users file so they match it.
+// The changes are written to "team-users.csv" to confirm before running.
+func reconcileTeamUsers(logger *logrus.Logger, appConfig *config.Configuration, teams *teamPayload.TeamIndex) (err error) {
+	teamUsers := teamUserMapping.NewTeamUsers()
+	if err = teamUsers.Load(appConfig.TeamUsersFile); err != nil {
+		return fmt.Errorf("could not load team users '%s': %v", appConfig.TeamUsersFile, err)
+	}
+	desired := make(map[string]map[string]string)
+	for teamName, users := range *teamUsers {
+		teamName = appConfig.Ownership.Name(teamName)
+		desired[teamName] = make(map[string]string)
+		for _, user := range users {
+			desired[teamName][user.Email] = user.Role
+		}
+	}
+
+	configTeamUsers := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+	users, err := teamPayload.ListUsers(logger, &configTeamUsers)
+	if err != nil {
+		return err
+	}
+	changes, err := teamPayload.PlanMemberships(logger, configTeamUsers, teams, users, desired)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		logger.Info("Team users are up to date")
+		return nil
 	}
 
+	file, err := os.Create("team-users.csv")
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"Action", "Team Name", "Email", "Role", "Current Role"})
+	for _, change := range changes {
+		logger.Infof("Team '%s': %s user '%s' %s", change.TeamName, change.Action, change.Email, change.Role)
+		_ = writer.Write([]string{change.Action, change.TeamName, change.Email, change.Role, change.OldRole})
+	}
+	writer.Flush()
+	_ = file.Close()
+
+	if appConfig.DryRun {
+		fmt.Println("\"team-users.csv\" has been written, not changing team users")
+		return nil
+	} else if !appConfig.Silent {
+		processDryRun("team-users.csv")
+	}
+
+	for _, change := range changes {
+		configApply := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+		if err = teamPayload.ApplyMembership(logger, &configApply, change); err != nil {
+			logger.Errorf("Could not %s user '%s' for team '%s'. Error %v", change.Action, change.Email, change.TeamName, err)
+		}
+	}
+	return nil
+}
+
+// cleanupTeams deletes, or strips the zones from, the teams the scoper owns that neither the team zone mapping nor a
+// group produced in this run. Only teams belonging to a mode that ran are considered, monitor teams being told apart from
+// mapped teams by the team prefix. The template and default teams are never touched.
+func cleanupTeams(logger *logrus.Logger,
+	appConfig *config.Configuration,
+	teams *teamPayload.TeamIndex,
+	desiredTeams map[string]bool,
+	teamMode bool,
+	monitorMode bool) {
+
+	if teamMode != monitorMode && appConfig.TeamPrefix == "" {
+		logger.Warnf("Monitor teams can not be told apart from mapped teams without a team prefix, run team and monitor modes together to clean up teams")
+		return
+	}
+
+	var staleTeams []teamPayload.TeamPayload
+	for teamName, team := range teams.Teams {
+		if desiredTeams[teamName] || teamName == appConfig.TeamTemplateName || team.IsDefaultTeam {
+			continue
+		}
+		if !appConfig.Ownership.IsOwned(team.Name, team.Description) {
+			logger.Debugf("Team '%s' not created by the scoper. Leaving...", teamName)
+			continue
+		}
+		if monitorTeam := isMonitorTeam(appConfig, teamName); monitorTeam && !monitorMode || !monitorTeam && !teamMode {
+			logger.Debugf("Team '%s' belongs to a mode that did not run. Leaving...", teamName)
+			continue
+		}
+		staleTeams = append(staleTeams, team)
+	}
+	if len(staleTeams) == 0 {
+		logger.Info("No teams to clean up")
+		return
+	}
+	sort.Slice(staleTeams, func(i, j int) bool {
+		return staleTeams[i].Name < staleTeams[j].Name
+	})
+
+	// List the teams and what will happen to them to confirm before running
+	file, err := os.Create("team-cleanup.csv")
+	if err != nil {
+		logger.Errorf("Could not create team cleanup report. Error %v", err)
+		return
+	}
+	writer := csv.NewWriter(file)
+	_ = writer.Write([]string{"Action", "Team Name", "Team ID", "Zone IDs"})
+	for _, team := range staleTeams {
+		logger.Infof("Team '%s' no longer mapped, will %s", team.Name, appConfig.TeamCleanup)
+		_ = writer.Write([]string{appConfig.TeamCleanup, team.Name, fmt.Sprintf("%d", team.ID), fmt.Sprintf("%v", team.ZoneIds)})
+	}
+	writer.Flush()
+	_ = file.Close()
+
+	if appConfig.DryRun {
+		fmt.Println("\"team-cleanup.csv\" has been written, not cleaning up teams")
+		return
+	} else if !appConfig.Silent {
+		processDryRun("team-cleanup.csv")
+	}
+
+	configCleanupTeam := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+	for _, team := range staleTeams {
+		switch appConfig.TeamCleanup {
+		case "delete":
+			logger.Infof("Deleting team '%s'", team.Name)
+			if err = teams.DeleteTeam(logger, &configCleanupTeam, &team); err != nil {
+				logger.Errorf("Could not delete team '%s'. Error %v", team.Name, err)
+			}
+		case "strip-zones":
+			// Keeping the team preserves its members and history while taking away everything it could see
+			logger.Infof("Stripping zones from team '%s'", team.Name)
+			team.IsAllZones = false
+			tz := &teamPayload.TeamPayload{}
+			if err = tz.UpdateTeamZoneMapping(logger, team.Name, []int64{}, &configCleanupTeam, &team); err != nil {
+				logger.Errorf("Could not strip zones from team '%s'. Error %v", team.Name, err)
+				continue
+			}
+			teams.Put(*tz)
+		}
+	}
+}
+
+// isMonitorTeam reports whether the team name carries the monitor team prefix
+func isMonitorTeam(appConfig *config.Configuration, teamName string) bool {
+	return appConfig.TeamPrefix != "" && strings.HasPrefix(teamName, appConfig.Ownership.Name(appConfig.TeamPrefix))
+}
+
+// groupScopeExpression builds the team scope expression matching every grouping label value that formed the group
+func groupScopeExpression(labels []string, groupLabels map[string]string) string {
+	var expressions []string
+	for _, label := range labels {
+		if value, exists := groupLabels[label]; exists {
+			expressions = append(expressions, fmt.Sprintf("%s = \"%s\"", label, value))
+		}
+	}
+	return strings.Join(expressions, " and ")
+}
+
+// runZonesCommand exports the zones to, or imports them from, the zones file. Zones are always retrieved fresh as a
+// backup or import must not work from a cached snapshot.
+func runZonesCommand(appConfig *config.Configuration, logger *logrus.Logger, cache *snapshotCache.Cache) (err error) {
+	zones := zonePayload.NewZonePayload()
+	configZones := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+	if err = zones.GetZones(logger, &configZones); err != nil {
+		return err
+	}
+
+	switch appConfig.Command {
+	case "zones export":
+		if err = zoneFile.FromZones(zones).Save(appConfig.ZonesFile); err != nil {
+			return err
+		}
+		logger.Infof("Exported %d zones to '%s'", len(zones.Zones), appConfig.ZonesFile)
+	case "zones import":
+		var f *zoneFile.ZoneFile
+		if f, err = zoneFile.Load(appConfig.ZonesFile); err != nil {
+			return err
+		}
+		logger.Infof("Importing %d zones from '%s'", len(f.Zones), appConfig.ZonesFile)
+		if !appConfig.DryRun {
+			cache.Invalidate(logger, zonesCacheKey(appConfig, cache))
+		}
+		return f.Import(logger, sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken), zones, appConfig.DryRun)
+	}
 	return nil
 }
 
@@ -320,7 +972,7 @@ func main() {
 	logger.SetOutput(os.Stdout)
 	logger.SetLevel(logrus.DebugLevel)
 
-	logger.Info("Sysdig Zone Scoper v9.5.9\n")
+	logger.Infof("Sysdig Zone Scoper %s\n", version)
 
 	appConfig := &config.Configuration{}
 	if err := appConfig.Build(logger); err != nil {
@@ -330,31 +982,109 @@ func main() {
 	// Set logging level based off configuration
 	setLogLevel(logger, appConfig)
 
+	cache := snapshotCache.NewCache(appConfig.CacheDir, appConfig.CacheTTL, appConfig.Refresh)
+
+	if appConfig.Command != "" {
+		if err = runZonesCommand(appConfig, logger, cache); err != nil {
+			logger.Fatalf("Failed to run '%s'. Error %v", appConfig.Command, err)
+		}
+		logger.Print("Finished...")
+		return
+	}
+
+	grouping, err := mdsNamespaces.NewGrouping(appConfig.GroupingLabels, appConfig.GroupingTemplate, appConfig.MissingLabelMode, appConfig.MissingLabelDefault)
+	if err != nil {
+		logger.Fatalf("Invalid grouping configuration. Error %v", err)
+	}
+	grouping.FallbackLabels = appConfig.FallbackLabels
+	grouping.UnassignedGroup = appConfig.UnassignedGroup
+	if grouping.EntityType, err = mdsNamespaces.LookupEntityType(appConfig.EntityType); err != nil {
+		logger.Fatalf("Invalid entity type. Error %v", err)
+	}
+
+	zoneNaming, err := zonePayload.NewZoneNaming(appConfig.ZoneNameTemplate, appConfig.ZoneDescTemplate)
+	if err != nil {
+		logger.Fatalf("Invalid zone naming configuration. Error %v", err)
+	}
+
+	if err = teamPayload.ValidateReconcileFields(appConfig.TeamUserOwnedFields); err != nil {
+		logger.Fatalf("Invalid team user owned fields. Error %v", err)
+	}
+
+	filters, err := mdsNamespaces.NewFilters(appConfig.IncludeClusters, appConfig.ExcludeClusters,
+		appConfig.IncludeNamespaces, appConfig.ExcludeNamespaces,
+		appConfig.IncludeLabels, appConfig.ExcludeLabels)
+	if err != nil {
+		logger.Fatalf("Invalid filter configuration. Error %v", err)
+	}
+
 	// We need zones for both the teams and zones operations so run this either way
 	fmt.Println("")
 	zones := zonePayload.NewZonePayload()
 	logger.Info("Getting list of Zones")
-	if err = getZones(appConfig, logger, zones); err != nil {
+	zoneMode := strings.Contains(strings.ToUpper(appConfig.Mode), "ZONE")
+	if err = getZones(appConfig, logger, cache, zones, zoneMode && !appConfig.DryRun); err != nil {
 		logger.Fatalf("Failed to retrieve zones. Error %v", err)
 	}
 
-	if strings.Contains(strings.ToUpper(appConfig.Mode), "ZONE") {
+	if zoneMode {
 		fmt.Println("")
 		logger.Info("------------------------------")
 		logger.Info("Running in 'Create Zones' mode")
 		logger.Info("------------------------------")
 
 		logger.Info("Running in 'Create Zone' mode")
+		// Load the optional mapping of zones to their cloud, host and image scopes
+		var targetScopes *targetScopeMapping.TargetScopes
+		if appConfig.TargetScopeMappingFile != "" {
+			if targetScopes, err = getTargetScopeMapping(logger, appConfig); err != nil {
+				logger.Fatalf("Failed to load target scope mapping. Error: %v", err)
+			}
+		}
+
 		// Build distinct mapping list for cluster and namespaces
-		mdsNs := &mdsNamespaces.NamespacePayload{}
-		logger.Infof("Getting mds Namespace list")
-		if err = getMDSNamespaces(appConfig, logger, mdsNs); err != nil {
-			logger.Fatalf("Failed to retrieve mds namespaces. Error %v", err)
+		groupResult, staleNamespaces := groupNamespaces(appConfig, logger, cache, grouping, filters)
+		distinctProducts := groupResult.Groups
+		zoneNames, zoneDescriptions, err := nameZones(appConfig, logger, zones, zoneNaming, groupResult, zonePayload.RunMetadata{
+			Time:       time.Now(),
+			Version:    version,
+			Mode:       appConfig.Mode,
+			EntityType: grouping.EntityType.Name,
+		})
+		if err != nil {
+			logger.Fatalf("Could not name zones. Error %v", err)
 		}
 
-		// Custom data manipulation
-		_ = dataManipulation.Manipulate(logger, mdsNs)
-		distinctProducts := mdsNs.DistinctClusterNamespaceByLabel(logger, appConfig.GroupingLabel)
+		// Hand curated zones from the definitions file are desired state alongside the label driven zones
+		var definedZones *zoneFile.ZoneFile
+		if appConfig.ZoneDefinitionsFile != "" {
+			if definedZones, err = getZoneDefinitions(logger, appConfig, zoneNames); err != nil {
+				logger.Fatalf("Failed to load zone definitions. Error: %v", err)
+			}
+		}
+
+		// Zones no group maps to anymore may have been renamed rather than removed, find them before anything changes
+		groupZones := make(map[string]bool)
+		for _, productName := range groupResult.GroupNames() {
+			groupZones[zoneNames[productName]] = true
+		}
+		if definedZones != nil {
+			for _, zone := range definedZones.Zones {
+				groupZones[zone.Name] = true
+			}
+		}
+		renamedZones := make(map[string]zonePayload.Zone)
+		claimedZones := make(map[string]bool)
+		for _, productName := range groupResult.GroupNames() {
+			if _, exists := zones.Zones[zoneNames[productName]]; exists {
+				continue
+			}
+			rules := kubernetesRules(grouping.EntityType, distinctProducts[productName])
+			if zone, found := findRenamedZone(appConfig, logger, zones, groupZones, claimedZones, zoneNames[productName], rules); found {
+				claimedZones[zone.Name] = true
+				renamedZones[productName] = zone
+			}
+		}
 
 		// Create a dry run data of sorts to output to CSV to confirm before running
 		file, err := os.Create("dry-run.csv")
@@ -366,13 +1096,46 @@ func main() {
 		}(file)
 		writer := csv.NewWriter(file)
 		defer writer.Flush()
-		_ = writer.Write([]string{"Mode", "Zone Name", "Cluster", "Namespace"})
-		for productName := range distinctProducts {
-			joinedClusters, joinedNamespaces := createClusterNSString(distinctProducts, productName)
-			if _, exists := zones.Zones[productName]; !exists {
-				_ = writer.Write([]string{"Create", productName, joinedClusters, joinedNamespaces})
+		_ = writer.Write([]string{"Mode", "Zone Name", "Cluster", "Namespace", "Workload", "Other Scopes"})
+		for _, productName := range groupResult.GroupNames() {
+			joinedClusters, joinedNamespaces, joinedWorkloads := createClusterNSString(distinctProducts, productName)
+			otherScopes := describeScopes(mappedScopes(targetScopes, productName))
+			zoneName := zoneNames[productName]
+			if renamedZone, renamed := renamedZones[productName]; renamed {
+				_ = writer.Write([]string{fmt.Sprintf("Rename from '%s'", renamedZone.Name), zoneName, joinedClusters, joinedNamespaces, joinedWorkloads, otherScopes})
+			} else if _, exists := zones.Zones[zoneName]; !exists {
+				_ = writer.Write([]string{"Create", zoneName, joinedClusters, joinedNamespaces, joinedWorkloads, otherScopes})
 			} else {
-				_ = writer.Write([]string{"Update", productName, joinedClusters, joinedNamespaces})
+				_ = writer.Write([]string{"Update", zoneName, joinedClusters, joinedNamespaces, joinedWorkloads, otherScopes})
+			}
+		}
+		if definedZones != nil {
+			for _, zone := range definedZones.Zones {
+				if _, exists := zones.Zones[zone.Name]; !exists {
+					_ = writer.Write([]string{"Create (defined)", zone.Name, "", "", "", describeScopes(zone.PayloadScopes())})
+				} else {
+					_ = writer.Write([]string{"Update (defined)", zone.Name, "", "", "", describeScopes(zone.PayloadScopes())})
+				}
+			}
+		}
+		// List the stale namespaces so their removal from zones can be confirmed
+		for _, entity := range staleNamespaces {
+			// A group only made of stale namespaces gets no zone at all
+			match, _, _ := grouping.Match(entity)
+			zoneName := zoneNames[match.Name]
+			logger.Infof("Stale Cluster '%s', Namespace '%s', Zone '%s', last seen %s", entity.Labels["kubernetes.cluster.name"],
+				entity.Labels["kubernetes.namespace.name"], zoneName, entity.LastSeen().Format(time.RFC3339))
+			staleEntity, _ := grouping.EntityType.ClusterNamespace(entity)
+			_ = writer.Write([]string{"Stale (excluded)", zoneName, staleEntity.Cluster, staleEntity.Namespace, staleEntity.Workload})
+		}
+		// List the zones the scoper owns that no group maps to anymore, these are deleted during cleanup when enabled
+		cleanupAction := "Unmapped (kept)"
+		if appConfig.ZoneCleanup == "delete" {
+			cleanupAction = "Delete"
+		}
+		for key, zone := range zones.Zones {
+			if !groupZones[key] && !claimedZones[key] && !appConfig.StaticZones[key] && appConfig.Ownership.IsOwned(zone.Name, zone.Description) {
+				_ = writer.Write([]string{cleanupAction, key, "", "", "", ""})
 			}
 		}
 		writer.Flush()
@@ -383,34 +1146,59 @@ func main() {
 			os.Exit(0)
 		} else {
 			if !appConfig.Silent {
-				processDryRun()
+				processDryRun("dry-run.csv")
 			}
 		}
 
+		// Zones are about to change, so the cached zone list can no longer be trusted
+		cache.Invalidate(logger, zonesCacheKey(appConfig, cache))
+
 		//Iterate through zones, if it does not already exist, we will create a blank one (update later all at once)
-		for productName := range distinctProducts {
+		for _, productName := range groupResult.GroupNames() {
 			fmt.Println("")
-			if _, exists := zones.Zones[productName]; !exists {
+			zoneName := zoneNames[productName]
+			if renamedZone, renamed := renamedZones[productName]; renamed {
+				// Renaming in place keeps the zone ID so teams referencing the zone keep working
+				logger.Infof("Zone '%s' renamed to '%s', will update zone", renamedZone.Name, zoneName)
+				delete(zones.Zones, renamedZone.Name)
+				renamedZone.Name = zoneName
+				if err = updateZone(appConfig, logger, zones, distinctProducts, grouping.EntityType, targetScopes, productName, &renamedZone); err != nil {
+					logger.Fatalf("Failed to rename zone '%s'. Error %v", productName, err)
+				}
+			} else if _, exists := zones.Zones[zoneName]; !exists {
 				var createdZone *zonePayload.Zone
 				logger.Debugf("Zone with product name '%s' does NOT exist, creating zone", productName)
 
-				if createdZone, err = createZone(appConfig, logger, zones, productName); err != nil {
+				if createdZone, err = createZone(appConfig, logger, zones, zoneName, zoneDescriptions[productName]); err != nil {
 					logger.Fatalf("Failed to create new zone '%s'. Error %v", productName, err)
 				}
 
-				if err = updateZone(appConfig, logger, zones, distinctProducts, productName, createdZone); err != nil {
+				if err = updateZone(appConfig, logger, zones, distinctProducts, grouping.EntityType, targetScopes, productName, createdZone); err != nil {
 					logger.Fatalf("Failed to update zone '%s'. Error %v", productName, err)
 				}
 			} else {
-				logger.Infof("Zone '%s' EXISTS, will update zone", productName)
+				logger.Infof("Zone '%s' EXISTS, will update zone", zoneName)
 
-				zone := zones.Zones[productName]
-				if err = updateZone(appConfig, logger, zones, distinctProducts, productName, &zone); err != nil {
+				zone := zones.Zones[zoneName]
+				if err = updateZone(appConfig, logger, zones, distinctProducts, grouping.EntityType, targetScopes, productName, &zone); err != nil {
 					logger.Fatalf("Failed to update zone '%s'. Error %v", productName, err)
 				}
 			}
 		}
 
+		if definedZones != nil {
+			fmt.Println("")
+			configDefinedZones := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+			if err = definedZones.Import(logger, configDefinedZones, zones, false); err != nil {
+				logger.Fatalf("Failed to reconcile defined zones. Error %v", err)
+			}
+			for _, definedZone := range definedZones.Zones {
+				zone := zones.Zones[definedZone.Name]
+				zone.Keep = true
+				zones.Zones[definedZone.Name] = zone
+			}
+		}
+
 		fmt.Println("")
 		//Setting static zones to keep
 		for key := range appConfig.StaticZones {
@@ -418,14 +1206,39 @@ func main() {
 			zone.Keep = true
 			zones.Zones[key] = zone
 		}
-		//Now we sync/cleanup our zones, deleting any that we have not decided to keep
+		//Now we sync/cleanup our zones, deleting any we own that we have not decided to keep
+		configDeleteZone := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
 		for key, zone := range zones.Zones {
-			if !zone.Keep {
-				logger.Infof("Zone '%s' not marked to keep. Deleting...", key)
+			if zone.Keep {
+				continue
+			}
+			if !appConfig.Ownership.IsOwned(zone.Name, zone.Description) {
+				logger.Debugf("Zone '%s' not created by the scoper. Leaving...", key)
+				continue
+			}
+			if appConfig.ZoneCleanup != "delete" {
+				logger.Infof("Zone '%s' not marked to keep. Set ZONE_CLEANUP=delete to delete it", key)
+				continue
+			}
+			logger.Infof("Zone '%s' not marked to keep. Deleting...", key)
+			if err = zones.DeleteZone(logger, &configDeleteZone, &zone); err != nil {
+				logger.Errorf("Could not delete zone '%s'. Error %v", key, err)
 			}
 		}
 	}
 
+	// Teams are fetched once and indexed rather than looked up one at a time
+	teams := teamPayload.NewTeamIndex()
+	desiredTeams := make(map[string]bool)
+	if strings.Contains(strings.ToUpper(appConfig.Mode), "TEAM") || strings.Contains(strings.ToUpper(appConfig.Mode), "MONITOR") {
+		fmt.Println("")
+		logger.Info("Getting list of Teams")
+		configGetTeams := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
+		if err = teams.GetTeams(logger, &configGetTeams); err != nil {
+			logger.Fatalf("Failed to retrieve teams. Error %v", err)
+		}
+	}
+
 	if strings.Contains(strings.ToUpper(appConfig.Mode), "TEAM") {
 		fmt.Println("")
 		logger.Info("------------------------------")
@@ -435,13 +1248,6 @@ func main() {
 		// Now lets create some teams
 		fmt.Println("")
 
-		// First get the template team to use and re-use
-		tb := &teamPayload.TeamBase{}
-		configGetTeamByName := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-		if err = tb.GetTeamByName(logger, &configGetTeamByName, appConfig.TeamTemplateName); err != nil {
-			logger.Fatalf("Could not retreive team template to use '%s'. Error %v", appConfig.TeamTemplateName, err)
-		}
-
 		//Process Team to Zone mapping
 		err, tzMapping := getTeamZoneMapping(logger, appConfig)
 		if tzMapping == nil || err != nil {
@@ -450,15 +1256,32 @@ func main() {
 
 		// Now create the team(s)
 		fmt.Println("")
-		for keyName, keyValue := range *tzMapping {
+		for keyName, teamMapping := range *tzMapping {
+			// Mapped teams are desired even when they fail below, so cleanup never removes them
+			teamName := appConfig.Ownership.Name(keyName)
+			desiredTeams[teamName] = true
+
+			// Teams use the default template unless the mapping overrides it
+			templateName := appConfig.TeamTemplateName
+			if teamMapping.Overrides.Template != "" {
+				templateName = teamMapping.Overrides.Template
+			}
+			templateTeam, exists := teams.Teams[templateName]
+			if !exists {
+				logger.Errorf("Could not find team template '%s' for team '%s'", templateName, keyName)
+				continue
+			}
+
 			var teamZoneIDs []int64
-			for _, val := range keyValue {
+			for _, val := range teamMapping.Zones {
 				if zone, exists := zones.Zones[val]; exists {
 					teamZoneIDs = append(teamZoneIDs, zone.ID)
+				} else if zone, exists = zones.Zones[appConfig.Ownership.Name(val)]; exists {
+					teamZoneIDs = append(teamZoneIDs, zone.ID)
 				}
 			}
-			logger.Infof("Team: '%s', ZoneIds %v", keyName, teamZoneIDs)
-			if err = createOrUpdateTeam(logger, appConfig, keyName, teamZoneIDs, &tb.Data[0]); err != nil {
+			logger.Infof("Team: '%s', ZoneIds %v", teamName, teamZoneIDs)
+			if err = createOrUpdateTeam(logger, appConfig, teams, teamName, teamZoneIDs, &templateTeam, teamMapping.Overrides); err != nil {
 				logger.Errorf("Could not create or update team '%s'. Error: %v", keyName, err)
 			}
 			fmt.Println("")
@@ -477,31 +1300,53 @@ func main() {
 		fmt.Println("")
 
 		// Build distinct mapping list for cluster and namespaces
-		mdsNs := &mdsNamespaces.NamespacePayload{}
-		logger.Infof("Getting mds Namespace list")
-		if err = getMDSNamespaces(appConfig, logger, mdsNs); err != nil {
-			logger.Fatalf("Failed to retrieve mds namespaces. Error %v", err)
-		}
-
-		// Custom data manipulation
-		_ = dataManipulation.Manipulate(logger, mdsNs)
-		distinctProducts := mdsNs.DistinctClusterNamespaceByLabel(logger, appConfig.GroupingLabel)
+		groupResult, _ := groupNamespaces(appConfig, logger, cache, grouping, filters)
 
 		// First get the template team to use and re-use
-		tb := &teamPayload.TeamBase{}
-		configGetTeamByName := sysdighttp.DefaultSysdigRequestConfig(appConfig.SysdigApiEndpoint, appConfig.SecureApiToken)
-		if err = tb.GetTeamByName(logger, &configGetTeamByName, appConfig.TeamTemplateName); err != nil {
-			logger.Fatalf("Could not retreive team template to use '%s'. Error %v", appConfig.TeamTemplateName, err)
+		templateTeam, exists := teams.Teams[appConfig.TeamTemplateName]
+		if !exists {
+			logger.Fatalf("Could not find team template '%s'", appConfig.TeamTemplateName)
 		}
 
-		for keyName := range distinctProducts {
-			teamName := fmt.Sprintf("%s%s", appConfig.TeamPrefix, keyName)
+		for _, keyName := range groupResult.GroupNames() {
+			teamName := appConfig.Ownership.Name(fmt.Sprintf("%s%s", appConfig.TeamPrefix, keyName))
+			// Groups are desired even when skipped below, skipping an update must never get the team cleaned up
+			desiredTeams[teamName] = true
+			if len(groupResult.Labels[keyName]) == 0 {
+				// A team without an agent scope would see everything, never create one for the unassigned group
+				logger.Warnf("Team '%s' has no grouping labels to scope by. Skipping...", teamName)
+				continue
+			}
+			if groupResult.Incomplete[keyName] {
+				// Scoping by the labels the group does have would show the team every group sharing them
+				logger.Warnf("Team '%s' has namespaces missing grouping labels or grouped by different labels, its scope would not match the group. Skipping...", teamName)
+				continue
+			}
 			logger.Infof("Team: '%s'", teamName)
-			if err = cRUDTeamMonitor(logger, appConfig, teamName, keyName, &tb.Data[0]); err != nil {
+			if err = cRUDTeamMonitor(logger, appConfig, teams, teamName, grouping.ScopeLabels(), groupResult.Labels[keyName], &templateTeam); err != nil {
 				logger.Errorf("Could not create or update team '%s'. Error: %v", keyName, err)
 			}
 		}
 	}
+
+	if appConfig.TeamUsersFile != "" && (strings.Contains(strings.ToUpper(appConfig.Mode), "TEAM") || strings.Contains(strings.ToUpper(appConfig.Mode), "MONITOR")) {
+		fmt.Println("")
+		logger.Info("--------------------------------")
+		logger.Info("Running 'Team Membership' phase")
+		logger.Info("--------------------------------")
+		if err = reconcileTeamUsers(logger, appConfig, teams); err != nil {
+			logger.Errorf("Could not reconcile team users. Error: %v", err)
+		}
+	}
+
+	if appConfig.TeamCleanup != "none" && (strings.Contains(strings.ToUpper(appConfig.Mode), "TEAM") || strings.Contains(strings.ToUpper(appConfig.Mode), "MONITOR")) {
+		fmt.Println("")
+		logger.Info("-----------------------------")
+		logger.Info("Running 'Team Cleanup' phase")
+		logger.Info("-----------------------------")
+		cleanupTeams(logger, appConfig, teams, desiredTeams,
+			strings.Contains(strings.ToUpper(appConfig.Mode), "TEAM"), strings.Contains(strings.ToUpper(appConfig.Mode), "MONITOR"))
+	}
 	logger.Print("Finished...")
 }
 
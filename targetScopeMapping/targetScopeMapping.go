@@ -0,0 +1,104 @@
+package targetScopeMapping
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TargetTypes are the non kubernetes zone scope target types the mapping can manage.
+var TargetTypes = map[string]bool{
+	"aws":   true,
+	"gcp":   true,
+	"azure": true,
+	"host":  true,
+	"image": true,
+}
+
+// TargetScopes maps a group name to the rule fields and values for each target type, e.g.
+// "API Support" -> "aws" -> "account" -> ["123456789012"].
+type TargetScopes map[string]map[string]map[string][]string
+
+// NewTargetScopes initializes and returns a new TargetScopes instance.
+func NewTargetScopes() *TargetScopes {
+	ts := make(TargetScopes)
+	return &ts
+}
+
+// ParseCSV parses CSV data from an io.Reader and fills the TargetScopes map. Each row is the group name, the target
+// type and the rule field, followed by one column per value.
+func (ts *TargetScopes) ParseCSV(r io.Reader) error {
+	csvReader := csv.NewReader(r)
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = -1
+
+	// Skip the header row
+	if _, err := csvReader.Read(); err != nil {
+		return err
+	}
+
+	line := 1
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line++
+
+		if len(record) < 4 {
+			return fmt.Errorf("line %d: expected group, target type, field and at least one value", line)
+		}
+		group, targetType, field := record[0], strings.ToLower(record[1]), record[2]
+		if !TargetTypes[targetType] {
+			return fmt.Errorf("line %d: unsupported target type '%s'", line, record[1])
+		}
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("line %d: missing rule field", line)
+		}
+
+		var values []string
+		for _, value := range record[3:] {
+			if strings.TrimSpace(value) != "" {
+				values = append(values, value)
+			}
+		}
+		// A scope without values would have no rules and match everything of its target type
+		if len(values) == 0 {
+			return fmt.Errorf("line %d: %s field '%s' has no values", line, targetType, field)
+		}
+
+		if (*ts)[group] == nil {
+			(*ts)[group] = make(map[string]map[string][]string)
+		}
+		if (*ts)[group][targetType] == nil {
+			(*ts)[group][targetType] = make(map[string][]string)
+		}
+		(*ts)[group][targetType][field] = append((*ts)[group][targetType][field], values...)
+	}
+	return nil
+}
+
+// TargetTypesFor returns the sorted target types mapped for the group.
+func (ts *TargetScopes) TargetTypesFor(group string) []string {
+	var targetTypes []string
+	for targetType := range (*ts)[group] {
+		targetTypes = append(targetTypes, targetType)
+	}
+	sort.Strings(targetTypes)
+	return targetTypes
+}
+
+// Fields returns the sorted rule fields mapped for the group and target type, with their values.
+func (ts *TargetScopes) Fields(group string, targetType string) (fields []string, values map[string][]string) {
+	values = (*ts)[group][targetType]
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, values
+}
@@ -0,0 +1,230 @@
+package teamPayload
+
+import (
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MembershipAdd    = "add"
+	MembershipUpdate = "update"
+	MembershipRemove = "remove"
+)
+
+// Membership is a user's membership of a team with the team role they hold in it.
+type Membership struct {
+	TeamID           int64  `json:"teamId,omitempty"`
+	UserID           int64  `json:"userId,omitempty"`
+	StandardTeamRole string `json:"standardTeamRole,omitempty"`
+	CustomTeamRoleID *int64 `json:"customTeamRoleId,omitempty"`
+}
+
+type User struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+// MembershipChange is a single difference between a team's memberships and the desired ones.
+type MembershipChange struct {
+	Action   string
+	TeamName string
+	TeamID   int64
+	Email    string
+	UserID   int64
+	Role     string // Desired role, empty when removing
+	OldRole  string // Current role, empty when adding
+}
+
+// Role returns the membership's custom role ID, or its standard role when it has no custom role.
+func (m Membership) Role() string {
+	if m.CustomTeamRoleID != nil {
+		return strconv.FormatInt(*m.CustomTeamRoleID, 10)
+	}
+	return m.StandardTeamRole
+}
+
+// NewMembership returns the membership for a role, a number being a custom role ID and anything else a standard role.
+func NewMembership(role string) Membership {
+	if customTeamRoleID, err := strconv.ParseInt(role, 10, 64); err == nil {
+		return Membership{CustomTeamRoleID: &customTeamRoleID}
+	}
+	return Membership{StandardTeamRole: strings.ToUpper(role)}
+}
+
+// getPages requests the path a page at a time, passing each response to decode, until every matched item is returned.
+func getPages(logger *logrus.Logger,
+	configGetPages *sysdighttp.SysdigRequestConfig,
+	path string,
+	decode func(response *http.Response) (page PageInfo, returned int, err error)) error {
+
+	configGetPages.Path = path
+	for offset := 0; ; {
+		configGetPages.Params = map[string]interface{}{
+			"offset": offset,
+			"limit":  teamPageLimit,
+		}
+		response, err := sysdighttp.SysdigRequest(logger, *configGetPages)
+		if err != nil {
+			return err
+		}
+		page, returned, err := decode(response)
+		if err != nil {
+			return err
+		}
+		offset += returned
+		if returned < teamPageLimit || offset >= page.Matched {
+			return nil
+		}
+	}
+}
+
+// ListUsers retrieves every user keyed by lower case email.
+func ListUsers(logger *logrus.Logger, configListUsers *sysdighttp.SysdigRequestConfig) (map[string]User, error) {
+	users := make(map[string]User)
+	err := getPages(logger, configListUsers, "/platform/v1/users", func(response *http.Response) (PageInfo, int, error) {
+		var page struct {
+			Page PageInfo `json:"page"`
+			Data []User   `json:"data"`
+		}
+		if err := sysdighttp.ResponseBodyToJson(response, &page); err != nil {
+			return PageInfo{}, 0, err
+		}
+		for _, user := range page.Data {
+			users[strings.ToLower(user.Email)] = user
+		}
+		return page.Page, len(page.Data), nil
+	})
+	if err != nil {
+		logger.Errorf("Could not retrieve users: %v", err)
+		return nil, err
+	}
+	logger.Debugf("Successfully retrieved '%d' users", len(users))
+	return users, nil
+}
+
+// ListMemberships retrieves every membership of the team.
+func ListMemberships(logger *logrus.Logger, configListMemberships *sysdighttp.SysdigRequestConfig, teamID int64) (memberships []Membership, err error) {
+	err = getPages(logger, configListMemberships, fmt.Sprintf("/platform/v1/teams/%d/users", teamID), func(response *http.Response) (PageInfo, int, error) {
+		var page struct {
+			Page PageInfo     `json:"page"`
+			Data []Membership `json:"data"`
+		}
+		if err := sysdighttp.ResponseBodyToJson(response, &page); err != nil {
+			return PageInfo{}, 0, err
+		}
+		memberships = append(memberships, page.Data...)
+		return page.Page, len(page.Data), nil
+	})
+	if err != nil {
+		logger.Errorf("Could not retrieve memberships of team %d: %v", teamID, err)
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// PlanMemberships compares the memberships of every team in desired, team name to user email to role, with the current
+// ones and returns the changes needed, sorted by team then email. Teams and users that do not exist are skipped with a
+// warning. Teams not in desired are left alone.
+func PlanMemberships(logger *logrus.Logger,
+	configPlan sysdighttp.SysdigRequestConfig,
+	teams *TeamIndex,
+	users map[string]User,
+	desired map[string]map[string]string) (changes []MembershipChange, err error) {
+
+	emails := make(map[int64]string)
+	for email, user := range users {
+		emails[user.ID] = email
+	}
+
+	var teamNames []string
+	for teamName := range desired {
+		teamNames = append(teamNames, teamName)
+	}
+	sort.Strings(teamNames)
+
+	for _, teamName := range teamNames {
+		team, exists := teams.Teams[teamName]
+		if !exists {
+			logger.Warnf("Team '%s' does not exist, skipping its users", teamName)
+			continue
+		}
+
+		configListMemberships := configPlan
+		memberships, err := ListMemberships(logger, &configListMemberships, team.ID)
+		if err != nil {
+			return nil, err
+		}
+		current := make(map[int64]Membership)
+		for _, membership := range memberships {
+			current[membership.UserID] = membership
+		}
+
+		var teamChanges []MembershipChange
+		for email, role := range desired[teamName] {
+			user, exists := users[email]
+			if !exists {
+				logger.Warnf("User '%s' does not exist, can not add them to team '%s'", email, teamName)
+				continue
+			}
+			change := MembershipChange{TeamName: teamName, TeamID: team.ID, Email: email, UserID: user.ID, Role: NewMembership(role).Role()}
+			if membership, isMember := current[user.ID]; !isMember {
+				change.Action = MembershipAdd
+			} else if membership.Role() != change.Role {
+				change.Action, change.OldRole = MembershipUpdate, membership.Role()
+			} else {
+				continue
+			}
+			teamChanges = append(teamChanges, change)
+		}
+		for userID, membership := range current {
+			email := emails[userID]
+			if _, isDesired := desired[teamName][email]; isDesired && email != "" {
+				continue
+			}
+			teamChanges = append(teamChanges, MembershipChange{
+				Action:   MembershipRemove,
+				TeamName: teamName,
+				TeamID:   team.ID,
+				Email:    email,
+				UserID:   userID,
+				OldRole:  membership.Role(),
+			})
+		}
+		sort.Slice(teamChanges, func(i, j int) bool {
+			return teamChanges[i].Email < teamChanges[j].Email
+		})
+		changes = append(changes, teamChanges...)
+	}
+	return changes, nil
+}
+
+// ApplyMembership sends the request adding, updating or removing the membership.
+func ApplyMembership(logger *logrus.Logger, configApply *sysdighttp.SysdigRequestConfig, change MembershipChange) error {
+	configApply.Path = fmt.Sprintf("/platform/v1/teams/%d/users/%d", change.TeamID, change.UserID)
+	switch change.Action {
+	case MembershipAdd, MembershipUpdate:
+		membership := NewMembership(change.Role)
+		configApply.Method = "PUT"
+		configApply.JSON = &membership
+		configApply.Headers = map[string]string{
+			"Content-Type": "application/json",
+		}
+	case MembershipRemove:
+		configApply.Method = "DELETE"
+	default:
+		return fmt.Errorf("unknown membership action '%s'", change.Action)
+	}
+
+	response, err := sysdighttp.SysdigRequest(logger, *configApply)
+	if err != nil {
+		logger.Errorf("Failed to %s user '%s' for team '%s': %v", change.Action, change.Email, change.TeamName, err)
+		return err
+	}
+	_ = response.Body.Close()
+	return nil
+}
@@ -6,11 +6,22 @@ import (
 	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"reflect"
 )
 
+// teamPageLimit is the most teams the teams endpoint returns per page
+const teamPageLimit = 200
+
 type TeamBase struct {
-	Page interface{}
-	Data []TeamPayload
+	Page PageInfo      `json:"page"`
+	Data []TeamPayload `json:"data"`
+}
+
+// PageInfo is the offset pagination of the teams endpoint
+type PageInfo struct {
+	Returned int `json:"returned"`
+	Offset   int `json:"offset"`
+	Matched  int `json:"matched"`
 }
 
 type TeamPayload struct {
@@ -18,14 +29,14 @@ type TeamPayload struct {
 	CustomTeamRoleID          *int64                `json:"customTeamRoleId,omitempty"`
 	Description               string                `json:"description"`
 	IsAllZones                bool                  `json:"isAllZones"`
-	IsDefaultTeam             bool                  `json:"isDefaultTeam"`
+	IsDefaultTeam             bool                  `json:"isDefaultTeam,omitempty"`
 	Name                      string                `json:"name"`
 	Scopes                    []Scope               `json:"scopes"`
 	StandardTeamRole          string                `json:"standardTeamRole"`
 	UiSettings                UISettings            `json:"uiSettings"`
 	ZoneIds                   []int64               `json:"zoneIds"`
 	Product                   string                `json:"product"`
-	ID                        int64                 `json:"id',omitempty"`
+	ID                        int64                 `json:"id,omitempty"`
 	Version                   int64                 `json:"version,omitempty"`
 }
 
@@ -47,21 +58,62 @@ type UISettings struct {
 	Theme string `json:"theme"`
 }
 
+// ListTeams retrieves every team matching the filter, e.g. "name:Dev", following the pagination until all matched
+// teams are returned. An empty filter lists every team.
+func (tb *TeamBase) ListTeams(logger *logrus.Logger,
+	configListTeams *sysdighttp.SysdigRequestConfig,
+	filter string) (err error) {
+
+	configListTeams.Path = "/platform/v1/teams"
+	tb.Data = nil
+	for offset := 0; ; {
+		configListTeams.Params = map[string]interface{}{
+			"offset": offset,
+			"limit":  teamPageLimit,
+		}
+		if filter != "" {
+			configListTeams.Params["filter"] = filter
+		}
+
+		var objListTeamsResponse *http.Response
+		if objListTeamsResponse, err = sysdighttp.SysdigRequest(logger, *configListTeams); err != nil {
+			return err
+		}
+		var page TeamBase
+		if err = sysdighttp.ResponseBodyToJson(objListTeamsResponse, &page); err != nil {
+			logger.Errorf("Could not unmarshal teams payload")
+			return err
+		}
+
+		tb.Data = append(tb.Data, page.Data...)
+		tb.Page = page.Page
+		offset += len(page.Data)
+		if len(page.Data) < teamPageLimit || offset >= page.Page.Matched {
+			break
+		}
+	}
+	logger.Debugf("Successfully retrieved '%d' teams", len(tb.Data))
+	return nil
+}
+
+// GetTeamByName retrieves the team with exactly the name, leaving Data empty when there is none. The name filter matches
+// partial names so the results are narrowed down to the exact match.
 func (tb *TeamBase) GetTeamByName(logger *logrus.Logger,
 	configGetTeamByName *sysdighttp.SysdigRequestConfig,
 	teamName string) (err error) {
 
-	var objGetTeamByNameResponse *http.Response
-	configGetTeamByName.Path = fmt.Sprintf("/platform/v1/teams?filter=name:%s", teamName)
-
-	if objGetTeamByNameResponse, err = sysdighttp.SysdigRequest(logger, *configGetTeamByName); err != nil {
+	if err = tb.ListTeams(logger, configGetTeamByName, fmt.Sprintf("name:%s", teamName)); err != nil {
+		logger.Errorf("Could not get team '%s'", teamName)
 		return err
 	}
 
-	if err = sysdighttp.ResponseBodyToJson(objGetTeamByNameResponse, tb); err != nil {
-		logger.Errorf("Could not get team '%s'", teamName)
-		return err
+	var matches []TeamPayload
+	for _, team := range tb.Data {
+		if team.Name == teamName {
+			matches = append(matches, team)
+		}
 	}
+	tb.Data = matches
 	logger.Debugf("Returning %+v", *tb)
 	return nil
 }
@@ -69,17 +121,19 @@ func (tb *TeamBase) GetTeamByName(logger *logrus.Logger,
 func (tz *TeamPayload) CreateTeamZoneMapping(logger *logrus.Logger,
 	appConfig *config.Configuration,
 	teamName string,
+	description string,
 	zoneIds []int64,
 	configCreateTeam *sysdighttp.SysdigRequestConfig,
 	templateTeamPayload *TeamPayload) (err error) {
 	var objCreateTeamResponse *http.Response
 
-	templateTeamPayload.ZoneIds = zoneIds
-	templateTeamPayload.Name = teamName
-	templateTeamPayload.Description = teamName
+	newTeam := NewTeamFromTemplate(templateTeamPayload)
+	newTeam.ZoneIds = zoneIds
+	newTeam.Name = teamName
+	newTeam.Description = description
 
 	configCreateTeam.Path = "/platform/v1/teams"
-	configCreateTeam.JSON = templateTeamPayload
+	configCreateTeam.JSON = &newTeam
 	configCreateTeam.Method = "POST"
 	configCreateTeam.Headers = map[string]string{
 		"Content-Type": "application/json",
@@ -96,6 +150,27 @@ func (tz *TeamPayload) CreateTeamZoneMapping(logger *logrus.Logger,
 	return nil
 }
 
+// NewTeamFromTemplate builds a new team from a deep copy of the template's role, permissions, scopes and settings. Only
+// these fields are copied, so the template's ID, version, name, description, zones and default flag never leak into the
+// new team and nothing done to the new team changes the template.
+func NewTeamFromTemplate(template *TeamPayload) TeamPayload {
+	team := TeamPayload{
+		AdditionalTeamPermissions: template.AdditionalTeamPermissions,
+		IsAllZones:                template.IsAllZones,
+		StandardTeamRole:          template.StandardTeamRole,
+		UiSettings:                template.UiSettings,
+		Product:                   template.Product,
+	}
+	if template.CustomTeamRoleID != nil {
+		customTeamRoleID := *template.CustomTeamRoleID
+		team.CustomTeamRoleID = &customTeamRoleID
+	}
+	if template.Scopes != nil {
+		team.Scopes = append([]Scope{}, template.Scopes...)
+	}
+	return team
+}
+
 func (tz *TeamPayload) UpdateTeamZoneMapping(logger *logrus.Logger,
 	teamName string,
 	zoneIds []int64,
@@ -123,3 +198,141 @@ func (tz *TeamPayload) UpdateTeamZoneMapping(logger *logrus.Logger,
 	}
 	return nil
 }
+
+// TeamIndex holds every team by name and by ID, fetched once, so create or update decisions need no per team lookups.
+type TeamIndex struct {
+	Teams map[string]TeamPayload
+	Names map[int64]string
+}
+
+// NewTeamIndex creates a new instance of TeamIndex with initialized maps.
+func NewTeamIndex() *TeamIndex {
+	return &TeamIndex{
+		Teams: make(map[string]TeamPayload),
+		Names: make(map[int64]string),
+	}
+}
+
+// GetTeams retrieves every team into the index.
+func (ti *TeamIndex) GetTeams(logger *logrus.Logger, configGetTeams *sysdighttp.SysdigRequestConfig) (err error) {
+	tb := &TeamBase{}
+	if err = tb.ListTeams(logger, configGetTeams, ""); err != nil {
+		logger.Errorf("Could not retrieve teams: %v", err)
+		return err
+	}
+
+	ti.Teams = make(map[string]TeamPayload)
+	ti.Names = make(map[int64]string)
+	for _, team := range tb.Data {
+		ti.Put(team)
+	}
+	logger.Debugf("Indexed '%d' teams", len(ti.Teams))
+	return nil
+}
+
+// Put adds or replaces the team in the index.
+func (ti *TeamIndex) Put(team TeamPayload) {
+	ti.Teams[team.Name] = team
+	if team.ID != 0 {
+		ti.Names[team.ID] = team.Name
+	}
+}
+
+// ByID returns the team with the ID.
+func (ti *TeamIndex) ByID(id int64) (team TeamPayload, exists bool) {
+	name, exists := ti.Names[id]
+	if !exists {
+		return TeamPayload{}, false
+	}
+	team, exists = ti.Teams[name]
+	return team, exists
+}
+
+// DeleteTeam sends a request to delete the team and removes it from the index.
+func (ti *TeamIndex) DeleteTeam(logger *logrus.Logger, configDeleteTeam *sysdighttp.SysdigRequestConfig, team *TeamPayload) error {
+	configDeleteTeam.Path = fmt.Sprintf("/platform/v1/teams/%d", team.ID)
+	configDeleteTeam.Method = "DELETE"
+
+	response, err := sysdighttp.SysdigRequest(logger, *configDeleteTeam)
+	if err != nil {
+		logger.Errorf("Failed to delete team: %v", err)
+		return err
+	}
+	_ = response.Body.Close()
+
+	delete(ti.Teams, team.Name)
+	delete(ti.Names, team.ID)
+	return nil
+}
+
+const (
+	FieldAgentScope  = "agentScope"  // The AGENT scope expression
+	FieldRole        = "role"        // StandardTeamRole and CustomTeamRoleID
+	FieldPermissions = "permissions" // AdditionalTeamPermissions
+)
+
+// ReconcileFields lists the fields of an existing team that are reconciled, unless marked as user owned.
+var ReconcileFields = []string{FieldAgentScope, FieldRole, FieldPermissions}
+
+// ValidateReconcileFields checks every field is one ReconcileFields knows about.
+func ValidateReconcileFields(fields []string) error {
+	for _, field := range fields {
+		known := false
+		for _, reconcileField := range ReconcileFields {
+			known = known || field == reconcileField
+		}
+		if !known {
+			return fmt.Errorf("unknown team field '%s', expected one of %v", field, ReconcileFields)
+		}
+	}
+	return nil
+}
+
+// Reconcile returns a copy of the existing team with its AGENT scope set to the expression and its role and permissions
+// taken from the template, leaving user owned fields as they are. The ID, name, description, zones and every other scope
+// are preserved. changed lists the fields that differ from the existing team.
+func (tz *TeamPayload) Reconcile(template *TeamPayload, agentExpression string, userOwned map[string]bool) (reconciled TeamPayload, changed []string) {
+	reconciled = *tz
+
+	if !userOwned[FieldAgentScope] {
+		var scopes []Scope
+		found := false
+		for _, scope := range tz.Scopes {
+			if scope.Type == "AGENT" {
+				if found {
+					continue
+				}
+				scope.Expression = agentExpression
+				found = true
+			}
+			scopes = append(scopes, scope)
+		}
+		if !found {
+			scopes = append(scopes, Scope{Expression: agentExpression, Type: "AGENT"})
+		}
+		reconciled.Scopes = scopes
+		if !reflect.DeepEqual(reconciled.Scopes, tz.Scopes) {
+			changed = append(changed, FieldAgentScope)
+		}
+	}
+
+	if !userOwned[FieldRole] {
+		reconciled.StandardTeamRole = template.StandardTeamRole
+		reconciled.CustomTeamRoleID = nil
+		if template.CustomTeamRoleID != nil {
+			customTeamRoleID := *template.CustomTeamRoleID
+			reconciled.CustomTeamRoleID = &customTeamRoleID
+		}
+		if reconciled.StandardTeamRole != tz.StandardTeamRole || !reflect.DeepEqual(reconciled.CustomTeamRoleID, tz.CustomTeamRoleID) {
+			changed = append(changed, FieldRole)
+		}
+	}
+
+	if !userOwned[FieldPermissions] {
+		reconciled.AdditionalTeamPermissions = template.AdditionalTeamPermissions
+		if reconciled.AdditionalTeamPermissions != tz.AdditionalTeamPermissions {
+			changed = append(changed, FieldPermissions)
+		}
+	}
+	return reconciled, changed
+}
@@ -0,0 +1,83 @@
+package teamPayload
+
+import (
+	"encoding/json"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/config"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newTemplate() TeamPayload {
+	customTeamRoleID := int64(7)
+	return TeamPayload{
+		AdditionalTeamPermissions: AdditionalPermissions{HasAgentCli: true, HasRapidResponse: true},
+		CustomTeamRoleID:          &customTeamRoleID,
+		Description:               "Template team",
+		IsDefaultTeam:             true,
+		Name:                      "Template",
+		Scopes:                    []Scope{{Expression: "container", Type: "HOST_CONTAINER"}},
+		UiSettings:                UISettings{Theme: "#112233"},
+		ZoneIds:                   []int64{1, 2},
+		Product:                   "SDS",
+		ID:                        42,
+		Version:                   3,
+	}
+}
+
+func TestNewTeamFromTemplateIsIndependent(t *testing.T) {
+	template := newTemplate()
+
+	first := NewTeamFromTemplate(&template)
+	first.Name = "Team 1"
+	first.ZoneIds = append(first.ZoneIds, 10)
+	first.Scopes[0].Expression = "changed"
+	first.Scopes = append(first.Scopes, Scope{Expression: `group = "one"`, Type: "AGENT"})
+	*first.CustomTeamRoleID = 99
+
+	second := NewTeamFromTemplate(&template)
+	pristine := newTemplate()
+	if want := NewTeamFromTemplate(&pristine); !reflect.DeepEqual(second, want) {
+		t.Errorf("second team depends on the first, got %+v want %+v", second, want)
+	}
+	if !reflect.DeepEqual(template, pristine) {
+		t.Errorf("template changed, got %+v want %+v", template, pristine)
+	}
+}
+
+func TestCreateTeamZoneMappingBody(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("could not unmarshal request body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"id": 100, "name": "Team 1"}`))
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	template := newTemplate()
+	configCreateTeam := sysdighttp.DefaultSysdigRequestConfig(server.URL, "token")
+	tz := &TeamPayload{}
+	if err := tz.CreateTeamZoneMapping(logger, &config.Configuration{}, "Team 1", "Team 1 description", []int64{5}, &configCreateTeam, &template); err != nil {
+		t.Fatalf("CreateTeamZoneMapping failed: %v", err)
+	}
+
+	for _, key := range []string{"id", "version", "isDefaultTeam"} {
+		if value, exists := body[key]; exists {
+			t.Errorf("POST body has template field '%s' = %v", key, value)
+		}
+	}
+	if body["name"] != "Team 1" || body["description"] != "Team 1 description" {
+		t.Errorf("POST body has name '%v' and description '%v'", body["name"], body["description"])
+	}
+	if tz.ID != 100 {
+		t.Errorf("created team ID is %d, want 100", tz.ID)
+	}
+}
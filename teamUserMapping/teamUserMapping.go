@@ -0,0 +1,130 @@
+package teamUserMapping
+
+import (
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRole is the team role given to users listed without one.
+const DefaultRole = "ROLE_TEAM_READ"
+
+// TeamUser is a user's membership of a team. Role is a standard team role, e.g. ROLE_TEAM_EDIT, or a custom role ID.
+type TeamUser struct {
+	Email string `yaml:"email"`
+	Role  string `yaml:"role"`
+}
+
+// TeamUsers maps a team name to its members.
+type TeamUsers map[string][]TeamUser
+
+type usersFile struct {
+	Teams []struct {
+		Name  string     `yaml:"name"`
+		Users []TeamUser `yaml:"users"`
+	} `yaml:"teams"`
+}
+
+// NewTeamUsers initializes and returns a new TeamUsers instance.
+func NewTeamUsers() *TeamUsers {
+	tu := make(TeamUsers)
+	return &tu
+}
+
+// Load fills the TeamUsers from a CSV file, or a YAML file when the extension is .yaml or .yml.
+func (tu *TeamUsers) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return tu.ParseYAML(file)
+	default:
+		return tu.ParseCSV(file)
+	}
+}
+
+// ParseCSV parses CSV data from an io.Reader and fills the TeamUsers map. Each row is the team name, the user's email
+// and optionally their team role.
+func (tu *TeamUsers) ParseCSV(r io.Reader) error {
+	csvReader := csv.NewReader(r)
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = -1
+
+	// Skip the header row
+	if _, err := csvReader.Read(); err != nil {
+		return err
+	}
+
+	line := 1
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line++
+
+		if len(record) < 2 || len(record) > 3 {
+			return fmt.Errorf("line %d: expected team name, email and an optional role", line)
+		}
+		user := TeamUser{Email: record[1]}
+		if len(record) == 3 {
+			user.Role = record[2]
+		}
+		if err = tu.add(record[0], user); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return nil
+}
+
+// ParseYAML parses a YAML list of teams, each with a name and a list of users with an email and optional role.
+func (tu *TeamUsers) ParseYAML(r io.Reader) error {
+	var f usersFile
+	if err := yaml.NewDecoder(r).Decode(&f); err != nil && err != io.EOF {
+		return err
+	}
+	for _, team := range f.Teams {
+		for _, user := range team.Users {
+			if err := tu.add(team.Name, user); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add validates and adds the user to the team, a user may only be listed once per team.
+func (tu *TeamUsers) add(teamName string, user TeamUser) error {
+	teamName = strings.TrimSpace(teamName)
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+	user.Role = strings.TrimSpace(user.Role)
+	if teamName == "" {
+		return fmt.Errorf("user '%s' has no team", user.Email)
+	}
+	if !strings.Contains(user.Email, "@") {
+		return fmt.Errorf("team '%s' has an invalid email '%s'", teamName, user.Email)
+	}
+	if user.Role == "" {
+		user.Role = DefaultRole
+	}
+	for _, existing := range (*tu)[teamName] {
+		if existing.Email == user.Email {
+			return fmt.Errorf("user '%s' is listed more than once for team '%s'", user.Email, teamName)
+		}
+	}
+	(*tu)[teamName] = append((*tu)[teamName], user)
+	return nil
+}
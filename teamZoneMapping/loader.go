@@ -0,0 +1,165 @@
+package teamZoneMapping
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Loader fills TeamZones from a team zone mapping in a particular format.
+type Loader interface {
+	Load(r io.Reader, tz *TeamZones) error
+}
+
+// CSVLoader loads the legacy CSV mapping, see ParseCSV.
+type CSVLoader struct{}
+
+// YAMLLoader loads the YAML mapping, see ParseYAML. JSON is loaded the same way as YAML is a superset of it.
+type YAMLLoader struct{}
+
+// teamFields are the fields a team may have in the YAML mapping.
+var teamFields = map[string]bool{
+	"name":         true,
+	"zones":        true,
+	"template":     true,
+	"role":         true,
+	"customRoleId": true,
+	"allZones":     true,
+	"permissions":  true,
+}
+
+type yamlTeam struct {
+	Name         string          `yaml:"name"`
+	Zones        []string        `yaml:"zones"`
+	Template     string          `yaml:"template"`
+	Role         string          `yaml:"role"`
+	CustomRoleID *int64          `yaml:"customRoleId"`
+	AllZones     *bool           `yaml:"allZones"`
+	Permissions  map[string]bool `yaml:"permissions"`
+}
+
+func (CSVLoader) Load(r io.Reader, tz *TeamZones) error {
+	return tz.ParseCSV(r)
+}
+
+func (YAMLLoader) Load(r io.Reader, tz *TeamZones) error {
+	return tz.ParseYAML(r)
+}
+
+// LoaderFor returns the loader for the file's extension, YAML for .yaml, .yml and .json and CSV for anything else.
+func LoaderFor(path string) Loader {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return YAMLLoader{}
+	default:
+		return CSVLoader{}
+	}
+}
+
+// LoadFile fills the TeamZones from the file with the loader for its extension.
+func (tz *TeamZones) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	return LoaderFor(path).Load(file, tz)
+}
+
+// ParseYAML parses a YAML or JSON mapping from an io.Reader and fills the TeamZones map. The mapping is a 'teams' list,
+// each team has a name, a list of zones and optionally the template, role or customRoleId, allZones and permissions
+// overrides. Unknown fields, duplicate teams and invalid overrides are reported with their line number.
+func (tz *TeamZones) ParseYAML(r io.Reader) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("team zone mapping is empty")
+		}
+		return err
+	}
+
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping with a 'teams' list", root.Line)
+	}
+
+	var teamsNode *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if key.Value != "teams" {
+			return fmt.Errorf("line %d: unknown field '%s', expected 'teams'", key.Line, key.Value)
+		}
+		teamsNode = root.Content[i+1]
+	}
+	if teamsNode == nil || teamsNode.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: expected a 'teams' list", root.Line)
+	}
+
+	for _, teamNode := range teamsNode.Content {
+		if err := tz.parseYAMLTeam(teamNode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tz *TeamZones) parseYAMLTeam(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a team with a name and zones", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !teamFields[key.Value] {
+			return fmt.Errorf("line %d: unknown team field '%s'", key.Line, key.Value)
+		}
+		if key.Value != "permissions" || value.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			if permission := value.Content[j]; !Permissions[permission.Value] {
+				return fmt.Errorf("line %d: unknown permission '%s'", permission.Line, permission.Value)
+			}
+		}
+	}
+
+	var team yamlTeam
+	if err := node.Decode(&team); err != nil {
+		return err // Decode errors already carry the line number
+	}
+	team.Name = strings.TrimSpace(team.Name)
+	if team.Name == "" {
+		return fmt.Errorf("line %d: team has no name", node.Line)
+	}
+	if _, exists := (*tz)[team.Name]; exists {
+		return fmt.Errorf("line %d: team '%s' is mapped more than once", node.Line, team.Name)
+	}
+	for _, zone := range team.Zones {
+		if strings.TrimSpace(zone) == "" {
+			return fmt.Errorf("line %d: team '%s' has an empty zone", node.Line, team.Name)
+		}
+	}
+
+	mapping := &TeamMapping{
+		Zones: team.Zones,
+		Overrides: TeamOverrides{
+			Template:         strings.TrimSpace(team.Template),
+			StandardTeamRole: strings.ToUpper(strings.TrimSpace(team.Role)),
+			CustomTeamRoleID: team.CustomRoleID,
+			Permissions:      team.Permissions,
+			IsAllZones:       team.AllZones,
+		},
+	}
+	if err := mapping.Overrides.Validate(mapping.Zones); err != nil {
+		return fmt.Errorf("line %d: team '%s' %v", node.Line, team.Name, err)
+	}
+	(*tz)[team.Name] = mapping
+	return nil
+}
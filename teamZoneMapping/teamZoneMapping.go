@@ -2,11 +2,40 @@ package teamZoneMapping
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-// TeamZones maps a team name to a list of zone labels.
-type TeamZones map[string][]string
+// Permissions are the additional team permission flags a team can override.
+var Permissions = map[string]bool{
+	"hasAgentCli":             true,
+	"hasAwsData":              true,
+	"hasBeaconMetrics":        true,
+	"hasInfrastructureEvents": true,
+	"hasRapidResponse":        true,
+	"hasSysdigCaptures":       true,
+}
+
+// TeamMapping is a team's zone labels along with any overrides of the template team.
+type TeamMapping struct {
+	Zones     []string
+	Overrides TeamOverrides
+}
+
+// TeamOverrides replace the template team's settings for a single team, unset fields keep the template's.
+type TeamOverrides struct {
+	Template         string          // Template team to use instead of TEAM_TEMPLATE_NAME
+	StandardTeamRole string          // Mutually exclusive with CustomTeamRoleID
+	CustomTeamRoleID *int64          // Mutually exclusive with StandardTeamRole
+	Permissions      map[string]bool // Additional team permission flag to value
+	IsAllZones       *bool
+}
+
+// TeamZones maps a team name to its zone labels and overrides.
+type TeamZones map[string]*TeamMapping
 
 // NewTeamZones initializes and returns a new TeamZones instance.
 func NewTeamZones() *TeamZones {
@@ -14,7 +43,9 @@ func NewTeamZones() *TeamZones {
 	return &tz
 }
 
-// ParseCSV parses CSV data from an io.Reader and fills the TeamZones map.
+// ParseCSV parses CSV data from an io.Reader and fills the TeamZones map. Each row is the team name followed by its
+// zone labels, any 'key=value' column whose key is an override sets that override instead, e.g. 'role=ROLE_TEAM_READ',
+// 'customRoleId=12', 'template=Audit Template', 'allZones=true' or 'hasAgentCli=false'.
 func (tz *TeamZones) ParseCSV(r io.Reader) error {
 	csvReader := csv.NewReader(r)
 	csvReader.TrimLeadingSpace = true
@@ -25,6 +56,7 @@ func (tz *TeamZones) ParseCSV(r io.Reader) error {
 		return err // Return the error if unable to read the header (could be EOF or a different error)
 	}
 
+	line := 1
 	for {
 		record, err := csvReader.Read()
 		if err == io.EOF {
@@ -33,17 +65,120 @@ func (tz *TeamZones) ParseCSV(r io.Reader) error {
 		if err != nil {
 			return err // Return any other error that might occur
 		}
+		line++
 
 		// We assume there is at least one field per row (the team name)
 		if len(record) < 1 {
 			continue // Skip rows with no fields
 		}
 
-		teamName := record[0]    // The first column is the team name
-		zoneLabels := record[1:] // All subsequent columns are zone labels
+		teamName := record[0] // The first column is the team name
+		mapping := tz.Team(teamName)
+		for _, column := range record[1:] { // All subsequent columns are zone labels or overrides
+			if key, value, isOverride := splitOverride(column); isOverride {
+				if err = mapping.Overrides.Set(key, value); err != nil {
+					return fmt.Errorf("line %d: %v", line, err)
+				}
+				continue
+			}
+			mapping.Zones = append(mapping.Zones, column)
+		}
+		if err = mapping.Overrides.Validate(mapping.Zones); err != nil {
+			return fmt.Errorf("line %d: team '%s' %v", line, teamName, err)
+		}
+	}
+	return nil
+}
+
+// Team returns the team's mapping, adding an empty one when the team is not mapped yet.
+func (tz *TeamZones) Team(teamName string) *TeamMapping {
+	mapping, exists := (*tz)[teamName]
+	if !exists {
+		mapping = &TeamMapping{}
+		(*tz)[teamName] = mapping
+	}
+	return mapping
+}
+
+// splitOverride splits a 'key=value' column, isOverride is false unless the key is a known override.
+func splitOverride(column string) (key string, value string, isOverride bool) {
+	parts := strings.SplitN(column, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	key, value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	switch key {
+	case "template", "role", "customRoleId", "allZones":
+		return key, value, true
+	}
+	return key, value, Permissions[key]
+}
+
+// Set sets the override by key.
+func (o *TeamOverrides) Set(key string, value string) error {
+	switch key {
+	case "template":
+		o.Template = value
+	case "role":
+		o.StandardTeamRole = strings.ToUpper(value)
+	case "customRoleId":
+		customTeamRoleID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid customRoleId '%s'", value)
+		}
+		o.CustomTeamRoleID = &customTeamRoleID
+	case "allZones":
+		allZones, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid allZones '%s'", value)
+		}
+		o.IsAllZones = &allZones
+	default:
+		if !Permissions[key] {
+			return fmt.Errorf("unknown override '%s'", key)
+		}
+		permission, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s'", key, value)
+		}
+		if o.Permissions == nil {
+			o.Permissions = make(map[string]bool)
+		}
+		o.Permissions[key] = permission
+	}
+	return nil
+}
 
-		// Appending the zones to the corresponding team
-		(*tz)[teamName] = append((*tz)[teamName], zoneLabels...)
+// Validate checks the overrides do not set both a standard and a custom role, nor allZones for a team with zones.
+func (o *TeamOverrides) Validate(zones []string) error {
+	if o.StandardTeamRole != "" && o.CustomTeamRoleID != nil {
+		return fmt.Errorf("can not override both role and customRoleId")
+	}
+	if o.IsAllZones != nil && *o.IsAllZones && len(zones) > 0 {
+		return fmt.Errorf("can not have zones and allZones")
 	}
 	return nil
 }
+
+// String lists the overrides that are set, e.g. "role=ROLE_TEAM_READ allZones=true".
+func (o TeamOverrides) String() string {
+	var overrides []string
+	if o.Template != "" {
+		overrides = append(overrides, fmt.Sprintf("template=%s", o.Template))
+	}
+	if o.StandardTeamRole != "" {
+		overrides = append(overrides, fmt.Sprintf("role=%s", o.StandardTeamRole))
+	}
+	if o.CustomTeamRoleID != nil {
+		overrides = append(overrides, fmt.Sprintf("customRoleId=%d", *o.CustomTeamRoleID))
+	}
+	if o.IsAllZones != nil {
+		overrides = append(overrides, fmt.Sprintf("allZones=%t", *o.IsAllZones))
+	}
+	var permissions []string
+	for permission, value := range o.Permissions {
+		permissions = append(permissions, fmt.Sprintf("%s=%t", permission, value))
+	}
+	sort.Strings(permissions)
+	return strings.Join(append(overrides, permissions...), " ")
+}
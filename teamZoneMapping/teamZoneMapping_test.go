@@ -0,0 +1,39 @@
+package teamZoneMapping
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllZonesWithZonesRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		load func(tz *TeamZones) error
+		want string
+	}{
+		{"csv", func(tz *TeamZones) error {
+			return tz.ParseCSV(strings.NewReader("Team Name,Zone Label\nAudit Team,Webservers,allZones=true\n"))
+		}, "line 2: team 'Audit Team' can not have zones and allZones"},
+		{"yaml", func(tz *TeamZones) error {
+			return tz.ParseYAML(strings.NewReader("teams:\n  - name: Audit Team\n    zones: [Webservers]\n    allZones: true\n"))
+		}, "line 2: team 'Audit Team' can not have zones and allZones"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.load(NewTeamZones())
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllZonesWithoutZonesAccepted(t *testing.T) {
+	tz := NewTeamZones()
+	if err := tz.ParseCSV(strings.NewReader("Team Name,Zone Label\nAudit Team,allZones=false,Webservers\nAll Team,allZones=true\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := (*tz)["All Team"]; got == nil || got.Overrides.IsAllZones == nil || !*got.Overrides.IsAllZones {
+		t.Errorf("All Team allZones not set: %+v", got)
+	}
+}
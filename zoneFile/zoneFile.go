@@ -0,0 +1,166 @@
+package zoneFile
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zonePayload"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zoneRules"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ZoneFile is a portable list of zones and their scopes, written as YAML or JSON depending on the file extension.
+type ZoneFile struct {
+	Zones []Zone `json:"zones" yaml:"zones"`
+}
+
+type Zone struct {
+	Name        string  `json:"name" yaml:"name"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Scopes      []Scope `json:"scopes" yaml:"scopes"`
+}
+
+type Scope struct {
+	TargetType string `json:"targetType" yaml:"targetType"`
+	Rules      string `json:"rules" yaml:"rules"`
+}
+
+// FromZones builds a zone file from the retrieved zones, sorted by name.
+func FromZones(zones *zonePayload.ZonePayload) *ZoneFile {
+	f := &ZoneFile{}
+	for _, zone := range zones.Zones {
+		fileZone := Zone{Name: zone.Name, Description: zone.Description}
+		for _, scpe := range zone.Scopes {
+			fileZone.Scopes = append(fileZone.Scopes, Scope{TargetType: scpe.TargetType, Rules: scpe.Rules})
+		}
+		f.Zones = append(f.Zones, fileZone)
+	}
+	sort.Slice(f.Zones, func(i, j int) bool {
+		return f.Zones[i].Name < f.Zones[j].Name
+	})
+	return f
+}
+
+// Load reads and validates a zone file, JSON when the extension is .json otherwise YAML.
+func Load(path string) (*ZoneFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ZoneFile{}
+	if isJSON(path) {
+		err = json.Unmarshal(data, f)
+	} else {
+		err = yaml.Unmarshal(data, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse zone file '%s': %v", path, err)
+	}
+	if err = f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid zone file '%s': %v", path, err)
+	}
+	return f, nil
+}
+
+// Save writes the zone file, JSON when the extension is .json otherwise YAML.
+func (f *ZoneFile) Save(path string) (err error) {
+	var data []byte
+	if isJSON(path) {
+		data, err = json.MarshalIndent(f, "", "  ")
+	} else {
+		data, err = yaml.Marshal(f)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Validate checks every zone has a unique name and every scope a target type and rules that parse.
+func (f *ZoneFile) Validate() error {
+	names := make(map[string]bool)
+	for i, zone := range f.Zones {
+		if strings.TrimSpace(zone.Name) == "" {
+			return fmt.Errorf("zone %d has no name", i+1)
+		}
+		if names[zone.Name] {
+			return fmt.Errorf("zone '%s' is defined more than once", zone.Name)
+		}
+		names[zone.Name] = true
+		for _, scpe := range zone.Scopes {
+			if strings.TrimSpace(scpe.TargetType) == "" {
+				return fmt.Errorf("zone '%s' has a scope without a target type", zone.Name)
+			}
+			if _, err := zoneRules.Parse(scpe.Rules); err != nil {
+				return fmt.Errorf("zone '%s' has invalid %s rules: %v", zone.Name, scpe.TargetType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Import creates every zone in the file that does not exist and updates the description and scopes of those that do.
+// System zones can not be changed and are skipped. Nothing is sent in dry run mode.
+func (f *ZoneFile) Import(logger *logrus.Logger,
+	requestConfig sysdighttp.SysdigRequestConfig,
+	zones *zonePayload.ZonePayload,
+	dryRun bool) (err error) {
+
+	for _, zone := range f.Zones {
+		scopes := zone.PayloadScopes()
+		existing, exists := zones.Zones[zone.Name]
+		switch {
+		case exists && existing.IsSystem:
+			logger.Infof("Zone '%s' is a system zone. Skipping...", zone.Name)
+		case exists:
+			logger.Infof("Zone '%s' EXISTS, will update zone", zone.Name)
+			if dryRun {
+				continue
+			}
+			configUpdate := requestConfig
+			if err = zones.UpdateZone(logger, &configUpdate, &zonePayload.UpdateZone{
+				ID:          existing.ID,
+				Name:        zone.Name,
+				Description: zone.Description,
+				Scopes:      scopes,
+			}); err != nil {
+				return fmt.Errorf("could not update zone '%s': %v", zone.Name, err)
+			}
+		default:
+			logger.Infof("Creating zone '%s'", zone.Name)
+			if dryRun {
+				continue
+			}
+			configCreate := requestConfig
+			var createdZone *zonePayload.Zone
+			if createdZone, err = zones.CreateNewZone(logger, &configCreate, &zonePayload.CreateZone{
+				Name:        zone.Name,
+				Description: zone.Description,
+				Scopes:      scopes,
+			}); err != nil {
+				return fmt.Errorf("could not create zone '%s': %v", zone.Name, err)
+			}
+			zones.Zones[createdZone.Name] = *createdZone
+		}
+	}
+	return nil
+}
+
+// PayloadScopes returns the zone's scopes as sent to the zones API.
+func (z Zone) PayloadScopes() []zonePayload.Scope {
+	scopes := make([]zonePayload.Scope, 0, len(z.Scopes))
+	for _, scpe := range z.Scopes {
+		scopes = append(scopes, zonePayload.Scope{TargetType: scpe.TargetType, Rules: scpe.Rules})
+	}
+	return scopes
+}
+
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
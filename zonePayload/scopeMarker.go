@@ -0,0 +1,70 @@
+package zonePayload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/zoneRules"
+	"regexp"
+	"strings"
+)
+
+const (
+	MergeReplace           = "replace"             // Replace every scope of the target types the scoper manages
+	MergeAppend            = "append"              // Add missing values to existing scopes, keeping everything else
+	MergeManagedScopesOnly = "managed-scopes-only" // Only replace scopes the scoper created, identified by the scope marker
+)
+
+// scopeMarkerPattern matches the marker recording the scopes the scoper wrote, e.g. "[zone-scoper-scopes:kubernetes#1a2b3c4d]"
+var scopeMarkerPattern = regexp.MustCompile(`\s*\[zone-scoper-scopes:[^\]]*\]`)
+
+// ScopeHash identifies a scope by its target type and normalised rules, so whitespace or quoting differences in the rules
+// returned by the API do not change it.
+func ScopeHash(scope Scope) string {
+	rules := scope.Rules
+	if expr, err := zoneRules.Parse(rules); err == nil {
+		rules = zoneRules.Render(expr)
+	}
+	sum := sha256.Sum256([]byte(scope.TargetType + "\x00" + rules))
+	return fmt.Sprintf("%s#%s", scope.TargetType, hex.EncodeToString(sum[:4]))
+}
+
+// ManagedScopes returns the scope hashes recorded in the zone description's scope marker.
+func ManagedScopes(description string) map[string]bool {
+	managed := make(map[string]bool)
+	marker := scopeMarkerPattern.FindString(description)
+	if marker == "" {
+		return managed
+	}
+	marker = strings.TrimSpace(marker)
+	marker = strings.TrimSuffix(strings.TrimPrefix(marker, "[zone-scoper-scopes:"), "]")
+	for _, hash := range strings.Split(marker, ",") {
+		if hash = strings.TrimSpace(hash); hash != "" {
+			managed[hash] = true
+		}
+	}
+	return managed
+}
+
+// HasScopeMarker reports whether the zone description carries a scope marker at all.
+func HasScopeMarker(description string) bool {
+	return scopeMarkerPattern.MatchString(description)
+}
+
+// IsManagedScope reports whether the scope is one the scoper wrote according to the zone description's scope marker.
+func IsManagedScope(description string, scope Scope) bool {
+	return ManagedScopes(description)[ScopeHash(scope)]
+}
+
+// WithScopeMarker replaces the scope marker in the description with one recording the scopes.
+func WithScopeMarker(description string, scopes []Scope) string {
+	description = strings.TrimSpace(scopeMarkerPattern.ReplaceAllString(description, ""))
+	if len(scopes) == 0 {
+		return description
+	}
+	hashes := make([]string, len(scopes))
+	for i, scope := range scopes {
+		hashes[i] = ScopeHash(scope)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s [zone-scoper-scopes:%s]", description, strings.Join(hashes, ",")))
+}
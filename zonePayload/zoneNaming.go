@@ -0,0 +1,126 @@
+package zonePayload
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+const (
+	MaxZoneNameLength        = 255
+	MaxZoneDescriptionLength = 1024
+
+	// descriptionReserve leaves room in the description for the ownership and scope markers appended after the template
+	descriptionReserve = 256
+
+	DefaultZoneNameTemplate        = `{{ .Value }}`
+	DefaultZoneDescriptionTemplate = `Zone for '{{ .Value }}'`
+)
+
+// ZoneNameData is passed to the zone name and description templates.
+type ZoneNameData struct {
+	Value          string            // Group value the zone is built from
+	Labels         map[string]string // Grouping label name to value the group was built from
+	Clusters       []string          // Sorted distinct clusters in the zone
+	NamespaceCount int               // Distinct cluster/namespace pairs in the zone
+	Run            RunMetadata
+}
+
+// RunMetadata describes the scoper run creating or updating the zone.
+type RunMetadata struct {
+	Time       time.Time
+	Version    string
+	Mode       string
+	EntityType string
+}
+
+// ZoneNaming renders zone names and descriptions from templates.
+type ZoneNaming struct {
+	NameTemplate        *template.Template
+	DescriptionTemplate *template.Template
+}
+
+var zoneTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"date":  func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// NewZoneNaming parses the name and description templates, empty templates use the defaults.
+func NewZoneNaming(nameTemplate string, descriptionTemplate string) (*ZoneNaming, error) {
+	if nameTemplate == "" {
+		nameTemplate = DefaultZoneNameTemplate
+	}
+	if descriptionTemplate == "" {
+		descriptionTemplate = DefaultZoneDescriptionTemplate
+	}
+
+	nameTmpl, err := template.New("zoneName").Funcs(zoneTemplateFuncs).Option("missingkey=zero").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse zone name template: %v", err)
+	}
+	descriptionTmpl, err := template.New("zoneDescription").Funcs(zoneTemplateFuncs).Option("missingkey=zero").Parse(descriptionTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse zone description template: %v", err)
+	}
+	return &ZoneNaming{NameTemplate: nameTmpl, DescriptionTemplate: descriptionTmpl}, nil
+}
+
+// Name renders the zone name, failing when it is empty. The name is not sanitised yet so any prefix can be added first,
+// see SanitizeZoneName.
+func (n *ZoneNaming) Name(data ZoneNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := n.NameTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render zone name for '%s': %v", data.Value, err)
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("zone name for '%s' is empty", data.Value)
+	}
+	return name, nil
+}
+
+// Description renders and sanitises the zone description.
+func (n *ZoneNaming) Description(data ZoneNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := n.DescriptionTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render zone description for '%s': %v", data.Value, err)
+	}
+	return SanitizeZoneDescription(buf.String()), nil
+}
+
+// SanitizeZoneName replaces control characters with spaces, collapses whitespace and truncates the name to the length
+// the zones API accepts.
+func SanitizeZoneName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, name)
+	return truncate(strings.Join(strings.Fields(name), " "), MaxZoneNameLength)
+}
+
+// SanitizeZoneDescription strips control characters and truncates the description, leaving room for the markers.
+func SanitizeZoneDescription(description string) string {
+	description = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, description)
+	return truncate(strings.TrimSpace(description), MaxZoneDescriptionLength-descriptionReserve)
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return strings.TrimSpace(string(runes[:length]))
+}
@@ -37,9 +37,10 @@ type CreateZone struct {
 }
 
 type UpdateZone struct {
-	ID     int64   `json:"id"`
-	Name   string  `json:"name"`
-	Scopes []Scope `json:"scopes"`
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Scopes      []Scope `json:"scopes"`
 }
 
 type Scope struct {
@@ -60,10 +61,41 @@ func NewZonePayload() *ZonePayload {
 	}
 }
 
+// GetZones retrieves every zone, following the page cursor until the last page.
 func (p *ZonePayload) GetZones(logger *logrus.Logger, configZones *sysdighttp.SysdigRequestConfig) (err error) {
-	var objFetchZonesResponse *http.Response
 	configZones.Path = "/platform/v1/zones"
+	configZones.Params = nil
+
+	p.Zones = make(map[string]Zone)
+	seenCursors := make(map[string]bool)
+	for {
+		var zoneData ZoneData
+		if err = getZonePage(logger, configZones, &zoneData); err != nil {
+			return err
+		}
+		for _, zone := range zoneData.Data {
+			p.Zones[zone.Name] = zone
+		}
+
+		if zoneData.Page.Next == nil || *zoneData.Page.Next == "" {
+			break
+		}
+		cursor := *zoneData.Page.Next
+		if seenCursors[cursor] {
+			return fmt.Errorf("zones page cursor '%s' was returned twice", cursor)
+		}
+		seenCursors[cursor] = true
+		configZones.Params = map[string]interface{}{
+			"cursor": cursor,
+		}
+	}
 
+	logger.Debugf("Successfully retrieved '%d' zones", len(p.Zones))
+	return nil
+}
+
+func getZonePage(logger *logrus.Logger, configZones *sysdighttp.SysdigRequestConfig, zoneData *ZoneData) (err error) {
+	var objFetchZonesResponse *http.Response
 	if objFetchZonesResponse, err = sysdighttp.SysdigRequest(logger, *configZones); err != nil {
 		logger.Errorf("Could not retrieve zones: %v", err)
 		return err
@@ -72,18 +104,10 @@ func (p *ZonePayload) GetZones(logger *logrus.Logger, configZones *sysdighttp.Sy
 		_ = Body.Close()
 	}(objFetchZonesResponse.Body)
 
-	var zoneData ZoneData
-	if err = sysdighttp.ResponseBodyToJson(objFetchZonesResponse, &zoneData); err != nil {
+	if err = sysdighttp.ResponseBodyToJson(objFetchZonesResponse, zoneData); err != nil {
 		logger.Errorf("Could not unmarshal zones payload: %v", err)
 		return err
 	}
-
-	p.Zones = make(map[string]Zone)
-	for _, zone := range zoneData.Data {
-		p.Zones[zone.Name] = zone
-	}
-
-	logger.Debugf("Successfully retrieved '%d' zones", len(p.Zones))
 	return nil
 }
 
@@ -135,3 +159,19 @@ func (p *ZonePayload) UpdateZone(logger *logrus.Logger, configUpdateZone *sysdig
 	p.Zones[createdZone.Name] = createdZone
 	return nil
 }
+
+// DeleteZone sends a request to delete an existing zone.
+func (p *ZonePayload) DeleteZone(logger *logrus.Logger, configDeleteZone *sysdighttp.SysdigRequestConfig, zone *Zone) error {
+	configDeleteZone.Path = fmt.Sprintf("/platform/v1/zones/%d", zone.ID)
+	configDeleteZone.Method = "DELETE"
+
+	response, err := sysdighttp.SysdigRequest(logger, *configDeleteZone)
+	if err != nil {
+		logger.Errorf("Failed to delete zone: %v", err)
+		return err
+	}
+	_ = response.Body.Close()
+
+	delete(p.Zones, zone.Name)
+	return nil
+}
@@ -0,0 +1,53 @@
+package zonePayload
+
+import (
+	"fmt"
+	"github.com/aaronm-sysdig/sysdig-zone-scoper/sysdighttp"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetZonesFollowsCursor(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"data": [{"id": 1, "name": "a"}, {"id": 2, "name": "b"}], "page": {"next": "c2"}}`,
+		"c2": `{"data": [{"id": 3, "name": "c"}], "page": {"next": "c3"}}`,
+		"c3": `{"data": [{"id": 4, "name": "d"}], "page": {"next": null}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, exists := pages[r.URL.Query().Get("cursor")]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	zones := NewZonePayload()
+	configZones := sysdighttp.DefaultSysdigRequestConfig(server.URL, "token")
+	if err := zones.GetZones(logger, &configZones); err != nil {
+		t.Fatalf("GetZones failed: %v", err)
+	}
+	if len(zones.Zones) != 4 || zones.Zones["d"].ID != 4 {
+		t.Errorf("retrieved zones %v, want a, b, c and d", zones.Zones)
+	}
+}
+
+func TestGetZonesRepeatedCursor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": [{"id": 1, "name": "a"}], "page": {"next": "same"}}`)
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	configZones := sysdighttp.DefaultSysdigRequestConfig(server.URL, "token")
+	if err := NewZonePayload().GetZones(logger, &configZones); err == nil {
+		t.Errorf("GetZones succeeded on a repeated cursor, want an error")
+	}
+}
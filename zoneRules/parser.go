@@ -0,0 +1,240 @@
+package zoneRules
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	tokenEOF = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenEq
+	tokenNotEq
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses zone rules, such as those in zonePayload.Scope.Rules, into an expression. Empty rules parse to nil.
+func Parse(rules string) (Expr, error) {
+	tokens, err := lex(rules)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, nil
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", next.value, next.pos)
+	}
+	return expr, nil
+}
+
+func lex(rules string) (tokens []token, err error) {
+	runes := []rune(rules)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case r == '=':
+			tokens = append(tokens, token{kind: tokenEq, value: "=", pos: i})
+			i++
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{kind: tokenNotEq, value: "!=", pos: i})
+			i += 2
+		case r == '"' || r == '\'':
+			start := i
+			var value strings.Builder
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: value.String(), pos: start})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-/:*", r)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the case insensitive keyword, consuming it when it is
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.value, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind int, description string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at position %d, found '%s'", description, t.pos, t.value)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	expr, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := &Or{Exprs: []Expr{expr}}
+	for p.keyword("or") {
+		if expr, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or.Exprs = append(or.Exprs, expr)
+	}
+	if len(or.Exprs) == 1 {
+		return or.Exprs[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{expr}
+	for p.keyword("and") {
+		if expr, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return AndOf(exprs...), nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	field, err := p.expect(tokenWord, "a field name")
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{Field: field.value}
+	switch t := p.next(); {
+	case t.kind == tokenEq:
+		comparison.Operator = OpEq
+	case t.kind == tokenNotEq:
+		comparison.Operator = OpNotEq
+	case t.kind == tokenWord && strings.EqualFold(t.value, OpIn):
+		comparison.Operator = OpIn
+	case t.kind == tokenWord && strings.EqualFold(t.value, "not") && p.keyword(OpIn):
+		comparison.Operator = OpNotIn
+	case t.kind == tokenWord && strings.EqualFold(t.value, OpStartsWith):
+		comparison.Operator = OpStartsWith
+	case t.kind == tokenWord && strings.EqualFold(t.value, OpContains):
+		comparison.Operator = OpContains
+	default:
+		return nil, fmt.Errorf("expected an operator after '%s' at position %d, found '%s'", field.value, t.pos, t.value)
+	}
+
+	if comparison.Operator != OpIn && comparison.Operator != OpNotIn {
+		value, err := p.expect(tokenString, "a quoted value")
+		if err != nil {
+			return nil, err
+		}
+		comparison.Values = []string{value.value}
+		return comparison, nil
+	}
+
+	if _, err = p.expect(tokenLParen, "'('"); err != nil {
+		return nil, err
+	}
+	for {
+		value, err := p.expect(tokenString, "a quoted value")
+		if err != nil {
+			return nil, err
+		}
+		comparison.Values = append(comparison.Values, value.value)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	if _, err = p.expect(tokenRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return comparison, nil
+}
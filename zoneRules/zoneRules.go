@@ -0,0 +1,216 @@
+package zoneRules
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	OpIn         = "in"
+	OpNotIn      = "not in"
+	OpEq         = "="
+	OpNotEq      = "!="
+	OpStartsWith = "startsWith"
+	OpContains   = "contains"
+)
+
+// Expr is a node of a zone scope rule expression.
+type Expr interface {
+	String() string
+}
+
+// Comparison compares a field against one value, or a list of values for 'in' and 'not in'.
+type Comparison struct {
+	Field    string
+	Operator string
+	Values   []string
+}
+
+// And matches when every expression matches.
+type And struct {
+	Exprs []Expr
+}
+
+// Or matches when any expression matches.
+type Or struct {
+	Exprs []Expr
+}
+
+// Not negates an expression.
+type Not struct {
+	Expr Expr
+}
+
+// In builds a 'field in (values)' comparison.
+func In(field string, values ...string) *Comparison {
+	return &Comparison{Field: field, Operator: OpIn, Values: values}
+}
+
+// Eq builds a 'field = value' comparison.
+func Eq(field string, value string) *Comparison {
+	return &Comparison{Field: field, Operator: OpEq, Values: []string{value}}
+}
+
+// StartsWith builds a 'field startsWith value' comparison.
+func StartsWith(field string, value string) *Comparison {
+	return &Comparison{Field: field, Operator: OpStartsWith, Values: []string{value}}
+}
+
+// AndOf joins the non nil expressions with 'and', flattening nested ands. A single expression is returned as is.
+func AndOf(exprs ...Expr) Expr {
+	and := &And{}
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case nil:
+		case *And:
+			and.Exprs = append(and.Exprs, e.Exprs...)
+		default:
+			and.Exprs = append(and.Exprs, e)
+		}
+	}
+	switch len(and.Exprs) {
+	case 0:
+		return nil
+	case 1:
+		return and.Exprs[0]
+	}
+	return and
+}
+
+// Render renders the expression as zone rules, an empty string for a nil expression.
+func Render(expr Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return expr.String()
+}
+
+// Quote quotes a value, escaping backslashes and double quotes.
+func Quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return fmt.Sprintf(`"%s"`, value)
+}
+
+func (c *Comparison) String() string {
+	quoted := make([]string, len(c.Values))
+	for i, value := range c.Values {
+		quoted[i] = Quote(value)
+	}
+	if c.Operator == OpIn || c.Operator == OpNotIn {
+		return fmt.Sprintf("%s %s (%s)", c.Field, c.Operator, strings.Join(quoted, ","))
+	}
+	return fmt.Sprintf("%s %s %s", c.Field, c.Operator, strings.Join(quoted, ","))
+}
+
+func (a *And) String() string {
+	parts := make([]string, len(a.Exprs))
+	for i, expr := range a.Exprs {
+		// 'or' binds looser than 'and' so it needs parentheses inside an 'and'
+		if _, isOr := expr.(*Or); isOr {
+			parts[i] = fmt.Sprintf("(%s)", expr)
+		} else {
+			parts[i] = expr.String()
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (o *Or) String() string {
+	parts := make([]string, len(o.Exprs))
+	for i, expr := range o.Exprs {
+		parts[i] = expr.String()
+	}
+	return strings.Join(parts, " or ")
+}
+
+func (n *Not) String() string {
+	if _, isComparison := n.Expr.(*Comparison); isComparison {
+		return fmt.Sprintf("not %s", n.Expr)
+	}
+	return fmt.Sprintf("not (%s)", n.Expr)
+}
+
+// Comparisons returns the comparisons joined by the top level 'and' of the expression.
+func Comparisons(expr Expr) (comparisons []*Comparison) {
+	switch e := expr.(type) {
+	case *Comparison:
+		comparisons = append(comparisons, e)
+	case *And:
+		for _, child := range e.Exprs {
+			if comparison, ok := child.(*Comparison); ok {
+				comparisons = append(comparisons, comparison)
+			}
+		}
+	}
+	return comparisons
+}
+
+// FieldValues returns the values the top level 'and' of the expression matches the field against with 'in' or '=',
+// ok is false when the field is not matched that way.
+func FieldValues(expr Expr, field string) (values []string, ok bool) {
+	for _, comparison := range Comparisons(expr) {
+		if comparison.Field == field && (comparison.Operator == OpIn || comparison.Operator == OpEq) {
+			values = append(values, comparison.Values...)
+			ok = true
+		}
+	}
+	return values, ok
+}
+
+// Merge adds the values of every 'in' or '=' comparison in add to the comparison on the same field in the top level 'and'
+// of base. ok is false, and base is returned untouched, unless base matches every one of those fields with 'in' or '='.
+func Merge(base Expr, add Expr) (merged Expr, ok bool) {
+	baseComparisons := make(map[string]*Comparison)
+	for _, comparison := range Comparisons(base) {
+		if comparison.Operator == OpIn || comparison.Operator == OpEq {
+			baseComparisons[comparison.Field] = comparison
+		}
+	}
+
+	addComparisons := Comparisons(add)
+	if len(addComparisons) == 0 {
+		return base, false
+	}
+	for _, comparison := range addComparisons {
+		if _, exists := baseComparisons[comparison.Field]; !exists {
+			return base, false
+		}
+	}
+
+	var exprs []Expr
+	for _, expr := range flatten(base) {
+		comparison, isComparison := expr.(*Comparison)
+		if !isComparison || baseComparisons[comparison.Field] != comparison {
+			exprs = append(exprs, expr)
+			continue
+		}
+
+		values := append([]string{}, comparison.Values...)
+		seen := make(map[string]bool)
+		for _, value := range values {
+			seen[value] = true
+		}
+		for _, addComparison := range addComparisons {
+			if addComparison.Field != comparison.Field {
+				continue
+			}
+			for _, value := range addComparison.Values {
+				if !seen[value] {
+					seen[value] = true
+					values = append(values, value)
+				}
+			}
+		}
+		exprs = append(exprs, In(comparison.Field, values...))
+	}
+	return AndOf(exprs...), true
+}
+
+// flatten returns the expressions joined by the top level 'and'
+func flatten(expr Expr) []Expr {
+	if and, isAnd := expr.(*And); isAnd {
+		return and.Exprs
+	}
+	return []Expr{expr}
+}
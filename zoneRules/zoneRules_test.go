@@ -0,0 +1,166 @@
+package zoneRules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRenderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"in", `clusterId in ("prod","test")`, `clusterId in ("prod","test")`},
+		{"not in", `namespace not in ("kube-system")`, `namespace not in ("kube-system")`},
+		{"equals", `namespace = "api"`, `namespace = "api"`},
+		{"not equals", `namespace != "api"`, `namespace != "api"`},
+		{"starts with", `namespace startsWith "api-"`, `namespace startsWith "api-"`},
+		{"single quotes", `namespace = 'api'`, `namespace = "api"`},
+		{"escaped quote", `namespace in ("a\"b")`, `namespace in ("a\"b")`},
+		{"escaped backslash", `namespace in ("a\\b","c")`, `namespace in ("a\\b","c")`},
+		{"case insensitive keywords", `clusterId IN ("a") AND namespace NOT IN ("b")`, `clusterId in ("a") and namespace not in ("b")`},
+		{"and", `clusterId in ("a") and namespace in ("b")`, `clusterId in ("a") and namespace in ("b")`},
+		{"or in and", `clusterId in ("a") and (namespace = "b" or namespace = "c")`, `clusterId in ("a") and (namespace = "b" or namespace = "c")`},
+		{"and in or", `clusterId = "a" and namespace = "b" or clusterId = "c"`, `clusterId = "a" and namespace = "b" or clusterId = "c"`},
+		{"nested and flattened", `clusterId = "a" and (namespace = "b" and workloadName = "c")`, `clusterId = "a" and namespace = "b" and workloadName = "c"`},
+		{"not", `not (namespace = "a" or namespace = "b")`, `not (namespace = "a" or namespace = "b")`},
+		{"empty", ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.rules)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.rules, err)
+			}
+			got := Render(expr)
+			if got != tt.want {
+				t.Fatalf("Render(Parse(%q)) = %q, want %q", tt.rules, got, tt.want)
+			}
+			reparsed, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(%q) of rendered rules failed: %v", got, err)
+			}
+			if !reflect.DeepEqual(reparsed, expr) {
+				t.Errorf("rendered rules %q parse to %#v, want %#v", got, reparsed, expr)
+			}
+		})
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	expr, err := Parse(`namespace in ("a\"b","c\\d","e,f")`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	values, ok := FieldValues(expr, "namespace")
+	if want := []string{`a"b`, `c\d`, `e,f`}; !ok || !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %q, want %q", values, want)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"trailing comma", `namespace in ("a",)`},
+		{"unterminated string", `namespace in ("a)`},
+		{"escaped closing quote", `namespace = "a\"`},
+		{"missing operator", `namespace "a"`},
+		{"missing value", `namespace =`},
+		{"unquoted value", `namespace = a`},
+		{"missing closing paren", `namespace in ("a"`},
+		{"unbalanced group", `(namespace = "a"`},
+		{"trailing and", `namespace = "a" and`},
+		{"trailing token", `namespace = "a" "b"`},
+		{"unexpected character", `namespace = "a" # comment`},
+		{"not without in", `namespace not ("a")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if expr, err := Parse(tt.rules); err == nil {
+				t.Errorf("Parse(%q) = %q, want an error", tt.rules, Render(expr))
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		add    string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "adds new values",
+			base:   `clusterId in ("a") and namespace in ("x")`,
+			add:    `clusterId in ("a","b") and namespace in ("y")`,
+			want:   `clusterId in ("a","b") and namespace in ("x","y")`,
+			wantOK: true,
+		},
+		{
+			name:   "equals becomes in",
+			base:   `clusterId = "a"`,
+			add:    `clusterId in ("b")`,
+			want:   `clusterId in ("a","b")`,
+			wantOK: true,
+		},
+		{
+			name:   "keeps other expressions",
+			base:   `clusterId in ("a") and namespace not in ("kube-system")`,
+			add:    `clusterId in ("b")`,
+			want:   `clusterId in ("a","b") and namespace not in ("kube-system")`,
+			wantOK: true,
+		},
+		{
+			name:   "escaped values",
+			base:   `namespace in ("a\"b")`,
+			add:    `namespace in ("c\\d","a\"b")`,
+			want:   `namespace in ("a\"b","c\\d")`,
+			wantOK: true,
+		},
+		{
+			name:   "field missing from base",
+			base:   `clusterId in ("a")`,
+			add:    `clusterId in ("a") and namespace in ("x")`,
+			want:   `clusterId in ("a")`,
+			wantOK: false,
+		},
+		{
+			name:   "base field negated",
+			base:   `namespace not in ("x")`,
+			add:    `namespace in ("y")`,
+			want:   `namespace not in ("x")`,
+			wantOK: false,
+		},
+		{
+			name:   "base is an or",
+			base:   `namespace = "x" or namespace = "y"`,
+			add:    `namespace in ("z")`,
+			want:   `namespace = "x" or namespace = "y"`,
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := Parse(tt.base)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.base, err)
+			}
+			add, err := Parse(tt.add)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.add, err)
+			}
+			merged, ok := Merge(base, add)
+			if ok != tt.wantOK {
+				t.Errorf("ok = %t, want %t", ok, tt.wantOK)
+			}
+			if got := Render(merged); got != tt.want {
+				t.Errorf("Merge = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}